@@ -0,0 +1,76 @@
+package sls
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+)
+
+type Compression string
+
+const (
+	CompressLz4     Compression = "lz4"
+	CompressZstd    Compression = "zstd"
+	CompressDeflate Compression = "deflate"
+	CompressNone    Compression = "none"
+)
+
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+
+func (c Compression) valid() bool {
+	switch c {
+	case "", CompressLz4, CompressZstd, CompressDeflate, CompressNone:
+		return true
+	default:
+		return false
+	}
+}
+
+// header 返回 X-Log-Compresstype 请求头, 不压缩时返回空字符串
+func (c Compression) header() string {
+	switch c {
+	case "":
+		return string(CompressLz4)
+	case CompressNone:
+		return ""
+	default:
+		return string(c)
+	}
+}
+
+func (c Compression) compress(data []byte) ([]byte, error) {
+	switch c {
+	case "", CompressLz4:
+		out := make([]byte, lz4.CompressBlockBound(len(data)))
+		var hashTable [1 << 16]int
+		n, err := lz4.CompressBlock(data, out, hashTable[:])
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case CompressZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	case CompressDeflate:
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressNone:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", c)
+	}
+}
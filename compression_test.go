@@ -0,0 +1,85 @@
+package sls
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"github.com/stretchr/testify/assert"
+)
+
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) { return zstd.NewReader(nil) })
+
+func TestCompression(t *testing.T) {
+	raw := bytes.Repeat([]byte(`{"level":"INFO","msg":"compression test"}`), 100)
+
+	for _, c := range []Compression{"", CompressLz4, CompressZstd, CompressDeflate, CompressNone} {
+		t.Run(string(c), func(t *testing.T) {
+			assert.True(t, c.valid())
+
+			data, err := c.compress(raw)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if c != CompressNone {
+				assert.Less(t, len(data), len(raw))
+			}
+
+			out, err := c.decompress(data, len(raw))
+			if assert.NoError(t, err) {
+				assert.Equal(t, raw, out)
+			}
+		})
+	}
+
+	t.Run("header", func(t *testing.T) {
+		assert.Equal(t, "lz4", Compression("").header())
+		assert.Equal(t, "zstd", CompressZstd.header())
+		assert.Equal(t, "deflate", CompressDeflate.header())
+		assert.Empty(t, CompressNone.header())
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		c := Compression("gzip")
+		assert.False(t, c.valid())
+		_, err := c.compress(raw)
+		assert.Error(t, err)
+		_, err = c.decompress(raw, len(raw))
+		assert.Error(t, err)
+	})
+}
+
+// decompress 为 compress 的逆操作, 用于在测试中还原请求体
+func (c Compression) decompress(data []byte, rawSize int) ([]byte, error) {
+	switch c {
+	case "", CompressLz4:
+		out := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(data, out)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case CompressZstd:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(data, make([]byte, 0, rawSize))
+	case CompressDeflate:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = zr.Close() }()
+		return io.ReadAll(zr)
+	case CompressNone:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", c)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 const (
 	DefaultBufferSize = 100
+	DefaultBatchBytes = 512 << 10
 	DefaultTimeout    = 1 * time.Second
 	DefaultInterval   = 3 * time.Second
 )
@@ -22,40 +23,89 @@ type Config struct {
 	// 例如: "cn-hangzhou-intranet.log.aliyuncs.com",
 	// 更多接入点参考: https://help.aliyun.com/document_detail/29008.html?spm=a2c4g.11174283.6.1118.292a1caaVMpfPu
 	Endpoint        string
-	AccessKey       string          // 密钥对: key
-	AccessSecret    string          // 密钥对: secret
-	Project         string          // 日志项目名称
-	Store           string          // 日志库名称
-	Topic           string          // 日志 __topic__ 字段
-	Source          string          // 日志 __source__ 字段, 可选, 默认为 hostname
-	BufferSize      int             // 本地缓存日志条数, 可选, 默认为 100
-	Timeout         time.Duration   // 写缓存最大等待时间, 可选, 默认为 1s
-	Interval        time.Duration   // 缓存刷新间隔, 可选, 默认为 3s
-	HttpClient      *http.Client    // HTTP 客户端, 可选, 默认为 http.DefaultClient
-	MessageModifier MessageModifier // 在发送前编辑日志内容, 可选, 默认为空
-	MessageFilter   MessageFilter   // 在发送前过滤日志内容, 可选, 默认为空
-	OnError         ErrorListener   // 错误回调, 可选, 默认为空
-	UseHttps        bool            // 是否在调用 PutLogs 时使用 Https, 可选, 默认为 false
+	AccessKey       string              // 密钥对: key, 未设置 Credentials 时必填
+	AccessSecret    string              // 密钥对: secret, 未设置 Credentials 时必填
+	Credentials     CredentialsProvider // 访问凭证提供者, 支持 STS 临时凭证及凭证轮转, 可选, 默认使用 AccessKey 和 AccessSecret
+	Project         string              // 日志项目名称
+	Store           string              // 日志库名称
+	Topic           string              // 日志 __topic__ 字段
+	Source          string              // 日志 __source__ 字段, 可选, 默认为 hostname
+	BufferSize      int                 // 本地缓存日志条数, 可选, 默认为 100
+	BatchBytes      int                 // 单批日志编码后的目标字节数, 达到后立即发送, 可选, 默认为 512KB
+	Timeout         time.Duration       // Push 数据超时时间, 可选, 默认为 1s
+	Overflow        OverflowPolicy      // 缓存已满时的写入策略, 可选, 默认阻塞等待
+	OverflowTimeout time.Duration       // 缓存已满时写入的最大等待时间, 仅对 OverflowBlockTimeout 有效, 可选, 默认为 1s
+	Interval        time.Duration       // 报告丢弃条数及重发本地缓存的间隔, 也是 Linger 的默认值, 可选, 默认为 3s. 调整发送延迟请设置 Linger
+	Linger          time.Duration       // 单批日志的最长等待时间, 到达后即使未满也立即发送, 可选, 默认与 Interval 相同
+	Concurrency     int                 // 并发发送请求数, 可选, 默认为 1
+	PartitionKey    string              // 分区字段, 设置后该字段值相同的日志由同一协程按序发送, 可选, 默认为空不保证顺序
+	HttpClient      *http.Client        // HTTP 客户端, 可选, 默认为 http.DefaultClient
+	MessageModifier MessageModifier     // 在发送前编辑日志内容, 可选, 默认为空
+	MessageFilter   MessageFilter       // 在发送前过滤日志内容, 可选, 默认为空时丢弃所有日志
+	OnError         ErrorListener       // 错误回调, Concurrency 大于 1 时可能被并发调用, 可选, 默认为空
+	UseHttps        bool                // 是否在调用 PutLogs 时使用 Https, 可选, 默认为 false
+	Compression     Compression         // 压缩算法, 支持 lz4, zstd, deflate 及 none, 可选, 默认为 lz4
+	MaxLogSize      int                 // 单条日志编码后的最大字节数, 不能超过 5MB, 可选, 默认为 1MB
+	Oversize        OversizePolicy      // 单条日志超出 MaxLogSize 时的处理策略, 可选, 默认截断最长的字段
+	Retry           RetryPolicy         // 发送失败时的重试策略, 可选, 默认最多尝试 3 次
+	SpoolDir        string              // 本地缓存目录, 发送失败的日志写入该目录并在恢复后按序重发, 可选, 默认为空不启用
+	SpoolMaxSize    int64               // 本地缓存目录容量上限 (字节), 可选, 默认为 100MB
+	SpoolPolicy     SpoolPolicy         // 本地缓存超出容量时的处理策略, 可选, 默认删除最旧的日志
+	Parser          Parser              // 解析 Write 写入的每行数据, 支持 JSONParser, LogfmtParser 及 RawParser, 可选, 默认为使用 Flatten 和 Time 的 JSONParser
+	Flatten         *FlattenOptions     // 解析 JSON 日志时将嵌套的对象展开为 "parent.child" 形式的字段, 仅在 Parser 为空时生效, 可选, 默认为空不展开
+	Time            *TimeOptions        // 解析 JSON 日志时提取日志时间的字段名, 格式及时区, 仅在 Parser 为空时生效, 可选, 默认解析 "time" 字段的 RFC3339 时间或数值时间戳
+	TimeNano        bool                // 是否在 Log.Time_ns 中发送日志时间的纳秒部分, 使同一秒内的日志按时间排序, 可选, 默认为 false
+	TimeNanoField   string              // 额外写入纳秒级 Unix 时间戳的字段名, 如 "__time_ns__", 可选, 默认为空不写入
+	Tags            map[string]string   // 所有日志共有的标签, 如 {"cluster": "prod"}, 可被 Message.Tags 及 "__tag__:" 开头的字段覆盖, 可选
+	MaxDestinations int                 // RoutingWriter 最多写入的目标 (Project, Store 和 Topic 的组合) 数量, 超出后写入新目标的日志返回 ErrTooManyDestinations, 可选, 默认为 64
 	uri             *url.URL
 }
 
+// parser 返回解析 Write 写入数据的 Parser, 未设置时使用 JSONParser
+func (c Config) parser() Parser {
+	if c.Parser != nil {
+		return c.Parser
+	}
+	return JSONParser{Flatten: c.Flatten, Time: c.Time}
+}
+
 func (c *Config) validate() (err error) {
-	if err := errors.Join(
+	errs := []error{
 		validator.Required("Endpoint", c.Endpoint),
-		validator.Required("AccessKey", c.AccessKey),
-		validator.Required("AccessSecret", c.AccessSecret),
 		validator.Required("Project", c.Project),
 		validator.Required("Store", c.Store),
 		validator.Required("Topic", c.Topic),
-	); err != nil {
+	}
+	if c.Credentials == nil {
+		errs = append(errs,
+			validator.Required("AccessKey", c.AccessKey),
+			validator.Required("AccessSecret", c.AccessSecret),
+		)
+	}
+	if err := errors.Join(errs...); err != nil {
 		return err
 	}
 
+	if c.Credentials == nil {
+		c.Credentials = StaticCredentials(c.AccessKey, c.AccessSecret, "")
+	}
+
+	c.validateOptions()
+
 	source, _ := os.Hostname()
 	c.Source = validator.Coalesce(c.Source, source)
-	c.BufferSize = validator.Coalesce(c.BufferSize, DefaultBufferSize)
 	c.Timeout = validator.Coalesce(c.Timeout, DefaultTimeout)
-	c.Interval = validator.Coalesce(c.Interval, DefaultInterval)
+	c.Retry = c.Retry.withDefaults()
+
+	c.Compression = validator.Coalesce(c.Compression, CompressLz4)
+	if !c.Compression.valid() {
+		return validator.IllegalArgument("Compression", fmt.Sprintf("%q is not supported", c.Compression))
+	}
+
+	c.MaxLogSize = validator.Coalesce(c.MaxLogSize, DefaultMaxLogSize)
+	if c.MaxLogSize > MaxLogGroupSize {
+		return validator.IllegalArgument("MaxLogSize", fmt.Sprintf("should not exceed %d", MaxLogGroupSize))
+	}
 
 	if c.HttpClient == nil {
 		c.HttpClient = http.DefaultClient
@@ -73,3 +123,14 @@ func (c *Config) validate() (err error) {
 	}
 	return
 }
+
+// validateOptions 填充与发送方式无关的缓存, 批次及本地缓存选项的默认值
+func (c *Config) validateOptions() {
+	c.BufferSize = validator.Coalesce(c.BufferSize, DefaultBufferSize)
+	c.Interval = validator.Coalesce(c.Interval, DefaultInterval)
+	c.BatchBytes = validator.Coalesce(c.BatchBytes, DefaultBatchBytes)
+	c.Linger = validator.Coalesce(c.Linger, c.Interval)
+	c.Concurrency = validator.Coalesce(c.Concurrency, 1)
+	c.OverflowTimeout = validator.Coalesce(c.OverflowTimeout, DefaultTimeout)
+	c.SpoolMaxSize = validator.Coalesce(c.SpoolMaxSize, DefaultSpoolMaxSize)
+}
@@ -1,6 +1,7 @@
 package sls
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -50,6 +51,20 @@ func TestConfig(t *testing.T) {
 		c = raw
 		c.Topic = " "
 		assert.Error(t, c.validate())
+
+		c = raw
+		c.AccessKey = " "
+		c.AccessSecret = " "
+		c.Credentials = EnvCredentials()
+		assert.NoError(t, c.validate())
+
+		c = raw
+		c.Compression = "gzip"
+		assert.Error(t, c.validate())
+
+		c = raw
+		c.MaxLogSize = MaxLogGroupSize + 1
+		assert.Error(t, c.validate())
 	})
 
 	t.Run("default", func(t *testing.T) {
@@ -77,6 +92,64 @@ func TestConfig(t *testing.T) {
 			assert.Equal(t, DefaultInterval, c.Interval)
 		}
 
+		c = raw
+		c.BatchBytes = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, DefaultBatchBytes, c.BatchBytes)
+		}
+
+		c = raw
+		c.Concurrency = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, 1, c.Concurrency)
+		}
+
+		c = raw
+		c.Linger = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, raw.Interval, c.Linger)
+		}
+
+		c = raw
+		c.OverflowTimeout = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, DefaultTimeout, c.OverflowTimeout)
+		}
+
+		c = raw
+		c.Retry = RetryPolicy{}
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, DefaultMaxAttempts, c.Retry.MaxAttempts)
+			assert.Equal(t, DefaultMaxElapsed, c.Retry.MaxElapsed)
+		}
+
+		c = raw
+		c.SpoolMaxSize = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, DefaultSpoolMaxSize, c.SpoolMaxSize)
+		}
+
+		c = raw
+		if assert.NoError(t, c.validate()) {
+			cred, err := c.Credentials.Credentials(context.Background())
+			if assert.NoError(t, err) {
+				assert.Equal(t, raw.AccessKey, cred.AccessKeyID)
+				assert.Equal(t, Secret(raw.AccessSecret), cred.AccessKeySecret)
+			}
+		}
+
+		c = raw
+		c.Compression = ""
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, CompressLz4, c.Compression)
+		}
+
+		c = raw
+		c.MaxLogSize = 0
+		if assert.NoError(t, c.validate()) {
+			assert.Equal(t, DefaultMaxLogSize, c.MaxLogSize)
+		}
+
 		c = raw
 		c.HttpClient = nil
 		if assert.NoError(t, c.validate()) {
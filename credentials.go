@@ -0,0 +1,173 @@
+package sls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	EnvAccessKeyID     = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	EnvAccessKeySecret = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	EnvSecurityToken   = "ALIBABA_CLOUD_SECURITY_TOKEN"
+
+	DefaultRefreshBefore = 5 * time.Minute
+)
+
+var ErrNoCredentials = errors.New("no credentials")
+
+type Credentials struct {
+	AccessKeyID     string
+	AccessKeySecret Secret
+	SecurityToken   string    // STS 临时凭证的安全令牌, 使用长期凭证时为空
+	Expiration      time.Time // 凭证过期时间, 零值表示不过期
+}
+
+func (c Credentials) expired(before time.Duration) bool {
+	return !c.Expiration.IsZero() && time.Now().Add(before).After(c.Expiration)
+}
+
+// CredentialsProvider 在每次发送日志前提供签名所用的凭证
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials 返回固定的凭证, token 为空时使用长期凭证
+func StaticCredentials(accessKeyID, accessKeySecret, securityToken string) CredentialsProvider {
+	c := Credentials{
+		AccessKeyID:     accessKeyID,
+		AccessKeySecret: Secret(accessKeySecret),
+		SecurityToken:   securityToken,
+	}
+	return CredentialsProviderFunc(func(context.Context) (Credentials, error) {
+		return c, nil
+	})
+}
+
+// EnvCredentials 每次从环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID,
+// ALIBABA_CLOUD_ACCESS_KEY_SECRET 和 ALIBABA_CLOUD_SECURITY_TOKEN 读取凭证
+func EnvCredentials() CredentialsProvider {
+	return CredentialsProviderFunc(func(context.Context) (c Credentials, err error) {
+		c = Credentials{
+			AccessKeyID:     os.Getenv(EnvAccessKeyID),
+			AccessKeySecret: Secret(os.Getenv(EnvAccessKeySecret)),
+			SecurityToken:   os.Getenv(EnvSecurityToken),
+		}
+		if c.AccessKeyID == "" || len(c.AccessKeySecret) == 0 {
+			err = fmt.Errorf("%w: %s or %s is empty", ErrNoCredentials, EnvAccessKeyID, EnvAccessKeySecret)
+		}
+		return
+	})
+}
+
+// FileCredentials 从 JSON 文件读取 STS 临时凭证, 文件格式与 STS AssumeRole 返回的 Credentials 一致:
+//
+//	{"AccessKeyId": "", "AccessKeySecret": "", "SecurityToken": "", "Expiration": "2006-01-02T15:04:05Z"}
+//
+// 文件被修改后自动重新读取, 适用于由 Sidecar 或 Secret 挂载并定期轮转的凭证文件.
+func FileCredentials(path string) CredentialsProvider {
+	return &fileCredentials{path: path}
+}
+
+type fileCredentials struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	cached  Credentials
+}
+
+func (p *fileCredentials) Credentials(context.Context) (c Credentials, err error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !info.ModTime().Equal(p.modTime) {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return c, err
+		}
+		if p.cached, err = parseSTSCredentials(data); err != nil {
+			return c, fmt.Errorf("parse credentials file %q: %w", p.path, err)
+		}
+		p.modTime = info.ModTime()
+	}
+	return p.cached, nil
+}
+
+// RefreshingCredentials 缓存 provider 返回的凭证, 在过期前 refreshBefore 时重新获取.
+// 重新获取失败时, 若缓存的凭证尚未过期则继续使用.
+func RefreshingCredentials(provider CredentialsProvider, refreshBefore time.Duration) CredentialsProvider {
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultRefreshBefore
+	}
+	return &refreshingCredentials{provider: provider, refreshBefore: refreshBefore}
+}
+
+type refreshingCredentials struct {
+	provider      CredentialsProvider
+	refreshBefore time.Duration
+	mu            sync.Mutex
+	cached        *Credentials
+}
+
+func (p *refreshingCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached != nil && !p.cached.expired(p.refreshBefore) {
+		return *p.cached, nil
+	}
+
+	c, err := p.provider.Credentials(ctx)
+	if err != nil {
+		if p.cached != nil && !p.cached.expired(0) {
+			logger.Printf("Refresh credentials: %v", err)
+			return *p.cached, nil
+		}
+		return c, err
+	}
+
+	p.cached = &c
+	return c, nil
+}
+
+type stsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	AccessKeySecret string `json:"AccessKeySecret"`
+	SecurityToken   string `json:"SecurityToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+func parseSTSCredentials(data []byte) (c Credentials, err error) {
+	var raw stsCredentials
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	if raw.AccessKeyID == "" || raw.AccessKeySecret == "" {
+		return c, fmt.Errorf("%w: AccessKeyId or AccessKeySecret is empty", ErrNoCredentials)
+	}
+
+	c = Credentials{
+		AccessKeyID:     raw.AccessKeyID,
+		AccessKeySecret: Secret(raw.AccessKeySecret),
+		SecurityToken:   raw.SecurityToken,
+	}
+	if raw.Expiration != "" {
+		c.Expiration, err = time.Parse(time.RFC3339, raw.Expiration)
+	}
+	return
+}
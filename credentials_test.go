@@ -0,0 +1,120 @@
+package sls
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("static", func(t *testing.T) {
+		c, err := StaticCredentials("key", "secret", "token").Credentials(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, Credentials{
+				AccessKeyID:     "key",
+				AccessKeySecret: Secret("secret"),
+				SecurityToken:   "token",
+			}, c)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		p := EnvCredentials()
+
+		t.Setenv(EnvAccessKeyID, "")
+		t.Setenv(EnvAccessKeySecret, "")
+		t.Setenv(EnvSecurityToken, "")
+		_, err := p.Credentials(ctx)
+		assert.ErrorIs(t, err, ErrNoCredentials)
+
+		t.Setenv(EnvAccessKeyID, "key")
+		t.Setenv(EnvAccessKeySecret, "secret")
+		t.Setenv(EnvSecurityToken, "token")
+		c, err := p.Credentials(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "key", c.AccessKeyID)
+			assert.Equal(t, Secret("secret"), c.AccessKeySecret)
+			assert.Equal(t, "token", c.SecurityToken)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		p := FileCredentials(path)
+
+		_, err := p.Credentials(ctx)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		writeFile := func(content string, modTime time.Time) {
+			assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		}
+
+		now := time.Now()
+		writeFile(`{"AccessKeyId":"key1","AccessKeySecret":"secret1","SecurityToken":"token1","Expiration":"2030-01-01T00:00:00Z"}`, now)
+		c, err := p.Credentials(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "key1", c.AccessKeyID)
+			assert.Equal(t, "token1", c.SecurityToken)
+			assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), c.Expiration)
+		}
+
+		writeFile(`{"AccessKeyId":"key2","AccessKeySecret":"secret2","SecurityToken":"token2"}`, now.Add(time.Second))
+		c, err = p.Credentials(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "key2", c.AccessKeyID)
+			assert.True(t, c.Expiration.IsZero())
+		}
+
+		writeFile(`{}`, now.Add(2*time.Second))
+		_, err = p.Credentials(ctx)
+		assert.ErrorIs(t, err, ErrNoCredentials)
+	})
+
+	t.Run("refreshing", func(t *testing.T) {
+		var (
+			count int
+			fail  error
+			ttl   time.Duration
+		)
+		p := RefreshingCredentials(CredentialsProviderFunc(func(context.Context) (Credentials, error) {
+			if fail != nil {
+				return Credentials{}, fail
+			}
+			count++
+			return Credentials{AccessKeyID: "key", Expiration: time.Now().Add(ttl)}, nil
+		}), time.Minute)
+
+		ttl = time.Hour
+		for i := 0; i < 3; i++ {
+			_, err := p.Credentials(ctx)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 1, count)
+
+		// 即将过期, 重新获取
+		ttl = 30 * time.Second
+		p.(*refreshingCredentials).cached.Expiration = time.Now().Add(ttl)
+		_, err := p.Credentials(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		// 获取失败时继续使用未过期的凭证
+		fail = errors.New("test error")
+		c, err := p.Credentials(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "key", c.AccessKeyID)
+
+		// 凭证已过期
+		p.(*refreshingCredentials).cached.Expiration = time.Now().Add(-time.Second)
+		_, err = p.Credentials(ctx)
+		assert.ErrorIs(t, err, fail)
+	})
+}
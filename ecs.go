@@ -0,0 +1,98 @@
+package sls
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMetadataURL     = "http://100.100.100.200"
+	DefaultMetadataTimeout = 5 * time.Second
+
+	ecsRolePath = "/latest/meta-data/ram/security-credentials/"
+)
+
+// ECSRoleProvider 从 ECS 实例元数据服务获取实例 RAM 角色的 STS 临时凭证,
+// 每次调用都会请求元数据服务, 一般通过 ECSRoleCredentials 使用带缓存的版本.
+type ECSRoleProvider struct {
+	RoleName    string        // 实例 RAM 角色名称, 可选, 默认使用实例绑定的角色
+	MetadataURL string        // 元数据服务地址, 可选, 默认为 http://100.100.100.200
+	Timeout     time.Duration // 请求元数据服务的超时时间, 可选, 默认为 5s
+	Client      *http.Client  // HTTP 客户端, 可选, 默认为 http.DefaultClient
+}
+
+// ECSRoleCredentials 返回带缓存的 ECS 实例 RAM 角色凭证, 在凭证过期前 5 分钟自动刷新
+func ECSRoleCredentials(roleName string) CredentialsProvider {
+	return RefreshingCredentials(&ECSRoleProvider{RoleName: roleName}, DefaultRefreshBefore)
+}
+
+func (p *ECSRoleProvider) Credentials(ctx context.Context) (c Credentials, err error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMetadataTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	role := p.RoleName
+	if role == "" {
+		data, err := p.get(ctx, ecsRolePath)
+		if err != nil {
+			return c, err
+		}
+		if role, _, _ = strings.Cut(strings.TrimSpace(string(data)), "\n"); role == "" {
+			return c, fmt.Errorf("%w: no RAM role attached to the instance", ErrNoCredentials)
+		}
+	}
+
+	data, err := p.get(ctx, ecsRolePath+role)
+	if err != nil {
+		return
+	}
+
+	var resp struct {
+		Code string `json:"Code"`
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return
+	}
+	if resp.Code != "Success" {
+		return c, fmt.Errorf("%w: metadata service returns code %q for role %q", ErrNoCredentials, resp.Code, role)
+	}
+	return parseSTSCredentials(data)
+}
+
+func (p *ECSRoleProvider) get(ctx context.Context, path string) (data []byte, err error) {
+	base := p.MetadataURL
+	if base == "" {
+		base = DefaultMetadataURL
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+path, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if data, err = io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service %s: %s", path, resp.Status)
+	}
+	return
+}
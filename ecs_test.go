@@ -0,0 +1,86 @@
+package sls
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECSRoleProvider(t *testing.T) {
+	const credentials = `{
+		"AccessKeyId": "STS.key",
+		"AccessKeySecret": "secret",
+		"Expiration": "2030-01-01T00:00:00Z",
+		"SecurityToken": "token",
+		"LastUpdated": "2029-12-31T18:00:00Z",
+		"Code": "Success"
+	}`
+
+	requests := &atomic.Int32{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case ecsRolePath:
+			requests.Add(1)
+			_, _ = w.Write([]byte("test-role\n"))
+		case ecsRolePath + "test-role":
+			requests.Add(1)
+			_, _ = w.Write([]byte(credentials))
+		case ecsRolePath + "failed-role":
+			_, _ = w.Write([]byte(`{"Code":"Failed"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	t.Run("auto role", func(t *testing.T) {
+		requests.Store(0)
+		p := &ECSRoleProvider{MetadataURL: srv.URL}
+		c, err := p.Credentials(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, Credentials{
+				AccessKeyID:     "STS.key",
+				AccessKeySecret: Secret("secret"),
+				SecurityToken:   "token",
+				Expiration:      time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			}, c)
+		}
+		assert.EqualValues(t, 2, requests.Load())
+	})
+
+	t.Run("named role", func(t *testing.T) {
+		requests.Store(0)
+		p := &ECSRoleProvider{RoleName: "test-role", MetadataURL: srv.URL + "/"}
+		_, err := p.Credentials(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, requests.Load())
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		p := &ECSRoleProvider{RoleName: "failed-role", MetadataURL: srv.URL}
+		_, err := p.Credentials(ctx)
+		assert.ErrorIs(t, err, ErrNoCredentials)
+
+		p = &ECSRoleProvider{RoleName: "unknown-role", MetadataURL: srv.URL}
+		_, err = p.Credentials(ctx)
+		assert.ErrorContains(t, err, "404")
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		requests.Store(0)
+		p := RefreshingCredentials(&ECSRoleProvider{RoleName: "test-role", MetadataURL: srv.URL}, DefaultRefreshBefore)
+		for i := 0; i < 3; i++ {
+			_, err := p.Credentials(ctx)
+			assert.NoError(t, err)
+		}
+		assert.EqualValues(t, 1, requests.Load())
+	})
+}
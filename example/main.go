@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"log/slog"
 	"os"
@@ -45,11 +46,18 @@ func main() {
 		panic(err)
 	}
 
-	// 进程结束前把存量日志推送到阿里云
-	defer func() { _ = writer.Close() }()
+	// 进程结束前把存量日志推送到阿里云, 最多等待 5s
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := writer.Shutdown(ctx); err != nil {
+			log.Printf("[EXAMPLE] shutdown: %s", err)
+		}
+	}()
 
 	// remoteHandler 将日志写入阿里云
-	remoteHandler := slog.NewJSONHandler(writer, &slog.HandlerOptions{
+	// 也可以使用 slog.NewJSONHandler(writer, ...), sls.NewHandler 省去了 JSON 序列化和解析的开销
+	remoteHandler := sls.NewHandler(writer, &slog.HandlerOptions{
 		Level:     slog.LevelInfo,
 		AddSource: false,
 	})
@@ -0,0 +1,89 @@
+package sls
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"strconv"
+)
+
+const DefaultSeparator = "."
+
+type ArrayMode int
+
+const (
+	ArrayAsJSON ArrayMode = iota // 数组保留为 JSON 字符串
+	ArrayIndex                   // 数组按下标展开, 如 "arr.0", "arr.1"
+)
+
+// FlattenOptions 控制如何将嵌套的 JSON 对象展开为 "parent.child" 形式的字段,
+// 便于在 SLS 中为每个子字段单独建立索引.
+type FlattenOptions struct {
+	MaxDepth  int       // 展开的最大层数, 更深的对象保留为 JSON 字符串, 可选, 默认为 0 不限制
+	Separator string    // 父子字段名之间的分隔符, 可选, 默认为 "."
+	Arrays    ArrayMode // 数组的处理方式, 可选, 默认保留为 JSON 字符串
+}
+
+// Flatten 展开 msg 中值为 JSON 对象的字段, 按 Arrays 的设置展开值为 JSON 数组的字段
+func (o FlattenOptions) Flatten(msg Message) Message {
+	var contents map[string]string
+	for k, v := range msg.Contents {
+		if len(v) == 0 || (v[0] != '{' && v[0] != '[') || !json.Valid([]byte(v)) {
+			continue
+		}
+		if contents == nil {
+			contents = maps.Clone(msg.Contents)
+		}
+		delete(contents, k)
+		if err := o.flatten(contents, k, json.RawMessage(v), 0); err != nil {
+			contents[k] = v
+		}
+	}
+	if contents != nil {
+		msg.Contents = contents
+	}
+	return msg
+}
+
+func (o FlattenOptions) flatten(contents map[string]string, key string, raw json.RawMessage, depth int) (err error) {
+	raw = bytes.TrimSpace(raw)
+	expand := len(raw) > 0 && (o.MaxDepth <= 0 || depth < o.MaxDepth)
+	sep := o.Separator
+	if sep == "" {
+		sep = DefaultSeparator
+	}
+
+	switch {
+	case expand && raw[0] == '{':
+		var m map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &m); err != nil {
+			return
+		}
+		if len(m) == 0 {
+			break
+		}
+		for k, v := range m {
+			if err = o.flatten(contents, key+sep+k, v, depth+1); err != nil {
+				return
+			}
+		}
+		return
+	case expand && raw[0] == '[' && o.Arrays == ArrayIndex:
+		var arr []json.RawMessage
+		if err = json.Unmarshal(raw, &arr); err != nil {
+			return
+		}
+		if len(arr) == 0 {
+			break
+		}
+		for i, v := range arr {
+			if err = o.flatten(contents, key+sep+strconv.Itoa(i), v, depth+1); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	contents[key], err = formatJsonValue(raw)
+	return
+}
@@ -0,0 +1,55 @@
+package sls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatten(t *testing.T) {
+	const raw = `{"msg":"hello","group":{"user":{"id":1,"name":"test"},"ids":[1,2],"empty":{}},"arr":[]}`
+
+	decode := func(t *testing.T, opts *FlattenOptions) map[string]string {
+		var msg Message
+		assert.NoError(t, msg.decode([]byte(raw), opts, nil))
+		return msg.Contents
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		contents := decode(t, nil)
+		assert.Equal(t, `{"user":{"id":1,"name":"test"},"ids":[1,2],"empty":{}}`, contents["group"])
+	})
+
+	t.Run("default", func(t *testing.T) {
+		assert.Equal(t, map[string]string{
+			"msg":             "hello",
+			"group.user.id":   "1",
+			"group.user.name": "test",
+			"group.ids":       "[1,2]",
+			"group.empty":     "{}",
+			"arr":             "[]",
+		}, decode(t, &FlattenOptions{}))
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		contents := decode(t, &FlattenOptions{MaxDepth: 1})
+		assert.Equal(t, `{"id":1,"name":"test"}`, contents["group.user"])
+		assert.Equal(t, "[1,2]", contents["group.ids"])
+	})
+
+	t.Run("array index", func(t *testing.T) {
+		contents := decode(t, &FlattenOptions{Separator: "_", Arrays: ArrayIndex})
+		assert.Equal(t, "1", contents["group_ids_0"])
+		assert.Equal(t, "2", contents["group_ids_1"])
+		assert.Equal(t, "test", contents["group_user_name"])
+		assert.Equal(t, "[]", contents["arr"])
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		mw := &MockWorker{}
+		w := Writer{worker: mw, filter: &MockFilter{}, parser: JSONParser{Flatten: &FlattenOptions{}}}
+		_, err := w.Write([]byte(raw))
+		assert.NoError(t, err)
+		assert.Equal(t, "test", mw.lastMessage.Contents["group.user.name"])
+	})
+}
@@ -1,8 +1,9 @@
 module github.com/gota33/aliyun-log-writer
 
-go 1.21
+go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/pierrec/lz4 v2.6.1+incompatible
 	github.com/stretchr/testify v1.8.4
 	google.golang.org/protobuf v1.31.0
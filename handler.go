@@ -0,0 +1,196 @@
+package sls
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// MessageWriter 接收已解析的日志, *Writer 和 *RoutingWriter 实现了该接口
+type MessageWriter interface {
+	WriteMessage(msg Message) error
+}
+
+// NewHandler 创建直接将 slog.Record 转换为 Message 的 slog.Handler,
+// 省去 slog.NewJSONHandler 先序列化再由 Writer 解析的开销.
+// 分组中的字段以 "." 连接为扁平的字段名, 如 "group.key".
+func NewHandler(w MessageWriter, opts *slog.HandlerOptions) slog.Handler {
+	h := &handler{writer: w}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+type handler struct {
+	writer MessageWriter
+	opts   slog.HandlerOptions
+	prefix string
+	groups []string
+	attrs  map[string]string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	msg := Message{
+		Time:     r.Time,
+		Contents: make(map[string]string, len(h.attrs)+r.NumAttrs()+3),
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	if rep := h.opts.ReplaceAttr; rep != nil {
+		a := rep(nil, slog.Time(slog.TimeKey, msg.Time))
+		if a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+			msg.Time = a.Value.Time()
+		} else {
+			h.appendAttr(msg.Contents, "", nil, a, false)
+		}
+	}
+
+	h.appendAttr(msg.Contents, "", nil, slog.Any(slog.LevelKey, r.Level), true)
+	h.appendAttr(msg.Contents, "", nil, slog.String(slog.MessageKey, r.Message), true)
+
+	if h.opts.AddSource && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		frame, _ := frames.Next()
+		source := &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+		h.appendAttr(msg.Contents, "", nil, slog.Any(slog.SourceKey, source), true)
+	}
+
+	for k, v := range h.attrs {
+		msg.Contents[k] = v
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(msg.Contents, h.prefix, h.groups, a, true)
+		return true
+	})
+
+	return h.writer.WriteMessage(msg)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.attrs = make(map[string]string, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		h2.attrs[k] = v
+	}
+	for _, a := range attrs {
+		h.appendAttr(h2.attrs, h.prefix, h.groups, a, true)
+	}
+	return &h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+func (h *handler) appendAttr(contents map[string]string, prefix string, groups []string, a slog.Attr, replace bool) {
+	a.Value = a.Value.Resolve()
+	if replace && h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if a.Key != "" {
+			prefix = prefix + a.Key + "."
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, item := range attrs {
+			h.appendAttr(contents, prefix, groups, item, replace)
+		}
+		return
+	}
+
+	if a.Key == "" {
+		return
+	}
+	contents[prefix+a.Key] = formatValue(a.Value)
+}
+
+func formatValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.FormatUint(v.Uint64(), 10)
+	case slog.KindFloat64:
+		return formatFloat(v.Float64())
+	case slog.KindBool:
+		return strconv.FormatBool(v.Bool())
+	case slog.KindDuration:
+		// 与 slog.JSONHandler 一致, 输出纳秒数
+		return strconv.FormatInt(int64(v.Duration()), 10)
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	}
+
+	switch value := v.Any().(type) {
+	case *slog.Source:
+		return fmt.Sprintf("%s:%d", value.File, value.Line)
+	case slog.Level:
+		return value.String()
+	case error:
+		return value.Error()
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%+v", value)
+		}
+		output, err := formatJsonValue(data)
+		if err != nil {
+			return string(data)
+		}
+		return output
+	}
+}
+
+// formatFloat 按 encoding/json 的规则格式化浮点数
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, 64)
+	if format == 'e' {
+		// 将 1e-07 转换为 1e-7
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,174 @@
+package sls
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	newLogger := func(opts *slog.HandlerOptions) (*slog.Logger, *MockWorker) {
+		mw := &MockWorker{}
+		return slog.New(NewHandler(&Writer{worker: mw, filter: &MockFilter{}}, opts)), mw
+	}
+
+	t.Run("normal", func(t *testing.T) {
+		logger, mw := newLogger(nil)
+		logger.Info("hello",
+			"str", "s",
+			"int", -1,
+			"uint", uint64(2),
+			"float", 1.5,
+			"bool", true,
+			"duration", time.Second,
+			"time", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			"err", errors.New("oops"),
+			"arr", []int{1, 2},
+			"obj", map[string]string{"a": "b"},
+		)
+
+		assert.Equal(t, 1, mw.count)
+		assert.WithinDuration(t, time.Now(), mw.lastMessage.Time, time.Second)
+		assert.Equal(t, map[string]string{
+			"level":    "INFO",
+			"msg":      "hello",
+			"str":      "s",
+			"int":      "-1",
+			"uint":     "2",
+			"float":    "1.5",
+			"bool":     "true",
+			"duration": "1000000000",
+			"time":     "2020-01-01T00:00:00Z",
+			"err":      "oops",
+			"arr":      "[1,2]",
+			"obj":      `{"a":"b"}`,
+		}, mw.lastMessage.Contents)
+	})
+
+	t.Run("level", func(t *testing.T) {
+		logger, mw := newLogger(&slog.HandlerOptions{Level: slog.LevelWarn})
+		logger.Info("ignored")
+		assert.Equal(t, 0, mw.count)
+
+		logger.Warn("warn")
+		assert.Equal(t, 1, mw.count)
+		assert.Equal(t, "WARN", mw.lastMessage.Contents["level"])
+	})
+
+	t.Run("attrs and groups", func(t *testing.T) {
+		logger, mw := newLogger(nil)
+		logger = logger.With("service", "demo").WithGroup("g1").With("a", 1).WithGroup("g2")
+		logger.Info("grouped",
+			"b", 2,
+			slog.Group("g3", "c", 3),
+			slog.Group("", "d", 4),
+			slog.Group("empty"),
+		)
+
+		assert.Equal(t, map[string]string{
+			"level":      "INFO",
+			"msg":        "grouped",
+			"service":    "demo",
+			"g1.a":       "1",
+			"g1.g2.b":    "2",
+			"g1.g2.g3.c": "3",
+			"g1.g2.d":    "4",
+		}, mw.lastMessage.Contents)
+	})
+
+	t.Run("source", func(t *testing.T) {
+		logger, mw := newLogger(&slog.HandlerOptions{AddSource: true})
+		logger.Info("source")
+		assert.True(t, strings.Contains(mw.lastMessage.Contents["source"], "handler_test.go:"))
+	})
+
+	t.Run("replace attr", func(t *testing.T) {
+		ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		var groups [][]string
+		logger, mw := newLogger(&slog.HandlerOptions{
+			ReplaceAttr: func(g []string, a slog.Attr) slog.Attr {
+				groups = append(groups, g)
+				switch a.Key {
+				case slog.TimeKey:
+					return slog.Time(slog.TimeKey, ts)
+				case slog.MessageKey:
+					a.Key = "message"
+				case "secret":
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		logger.WithGroup("g").Info("replaced", "secret", "123", "k", "v")
+
+		assert.Equal(t, ts, mw.lastMessage.Time)
+		assert.Equal(t, map[string]string{
+			"level":   "INFO",
+			"message": "replaced",
+			"g.k":     "v",
+		}, mw.lastMessage.Contents)
+		assert.Equal(t, []string{"g"}, groups[len(groups)-1])
+	})
+
+	t.Run("log valuer", func(t *testing.T) {
+		logger, mw := newLogger(nil)
+		logger.Info("valuer", "user", MockValuer{})
+		assert.Equal(t, "1", mw.lastMessage.Contents["user.id"])
+		assert.Equal(t, "demo", mw.lastMessage.Contents["user.name"])
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		mw := &MockWorker{}
+		h := NewHandler(&Writer{worker: mw, filter: &MockFilter{block: true}}, nil)
+		assert.NoError(t, h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)))
+		assert.Equal(t, 0, mw.count)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		mw := &MockWorker{err: errors.New("test error")}
+		h := NewHandler(&Writer{worker: mw, filter: &MockFilter{}}, nil)
+		err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+		assert.ErrorIs(t, err, mw.err)
+	})
+}
+
+func TestFormatFloat(t *testing.T) {
+	assert.Equal(t, "1.5", formatFloat(1.5))
+	assert.Equal(t, "1000000", formatFloat(1e6))
+	assert.Equal(t, "1e+21", formatFloat(1e21))
+	assert.Equal(t, "1e-7", formatFloat(1e-7))
+	assert.Equal(t, "0", formatFloat(0))
+	assert.Equal(t, "NaN", formatFloat(math.NaN()))
+}
+
+type MockValuer struct{}
+
+func (MockValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("id", 1), slog.String("name", "demo"))
+}
+
+func BenchmarkHandler(b *testing.B) {
+	w := &Writer{worker: &MockWorker{}, filter: &MockFilter{}}
+
+	b.Run("json", func(b *testing.B) {
+		logger := slog.New(slog.NewJSONHandler(w, nil))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark", "key", "value", "num", i)
+		}
+	})
+
+	b.Run("native", func(b *testing.B) {
+		logger := slog.New(NewHandler(w, nil))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark", "key", "value", "num", i)
+		}
+	})
+}
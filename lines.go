@@ -0,0 +1,122 @@
+package sls
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxPendingSize 为 Write 之间缓存的不完整行的字节数上限
+const MaxPendingSize = MaxLogGroupSize
+
+var ErrIncompleteLine = errors.New("incomplete line")
+
+// lineBuffer 将 Write 写入的数据按换行拆分为日志, 并保存末尾未以换行结尾的数据直到下次 Write
+type lineBuffer struct {
+	mu      sync.Mutex
+	pending []byte
+}
+
+// write 用 parser 解析 data 中的每行日志并交给 fn, 返回各行解析或写入失败的错误.
+// 只在拆分数据时持有锁, 解析和写入时不持有, 并发的 Write 不会互相等待.
+// b 为空时不在两次调用之间缓存数据.
+func (b *lineBuffer) write(data []byte, parser Parser, fn func(msg Message) error) (err error) {
+	if b == nil {
+		b = &lineBuffer{}
+		defer func() { err = errors.Join(err, b.flush(parser, fn)) }()
+	}
+
+	lines, err := b.take(data, isJSON(parser))
+	errs := []error{err}
+	for _, line := range lines {
+		errs = append(errs, writeLine(line, parser, fn))
+	}
+	return errors.Join(errs...)
+}
+
+// take 拆分出 data 中完整的行, 缓存末尾不完整的数据, 缓存超出上限时丢弃并返回错误
+func (b *lineBuffer) take(data []byte, objects bool) (lines [][]byte, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines = b.frame(data, objects)
+	if len(b.pending) > MaxPendingSize {
+		err = fmt.Errorf("%w: %d bytes exceeds %d", ErrIncompleteLine, len(b.pending), MaxPendingSize)
+		b.pending = nil
+	}
+	return
+}
+
+// flush 解析缓存中剩余的不完整数据, 用于关闭前
+func (b *lineBuffer) flush(parser Parser, fn func(msg Message) error) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	line := bytes.TrimSpace(b.pending)
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(line) == 0 {
+		return nil
+	}
+	if isJSON(parser) && !json.Valid(line) {
+		return fmt.Errorf("%w: %s", ErrIncompleteLine, abbreviate(line))
+	}
+	return writeLine(line, parser, fn)
+}
+
+// frame 返回 data 中完整的行, 末尾不完整的行留待下次 Write. objects 为 true 时完整的 JSON 对象无需以换行结尾:
+// 没有缓存数据且 data 本身是完整的 JSON 时整体作为一条日志, 兼容一次写入一条日志且不以换行结尾的调用方.
+func (b *lineBuffer) frame(data []byte, objects bool) (lines [][]byte) {
+	if objects && len(b.pending) == 0 && isObject(data) {
+		return [][]byte{data}
+	}
+
+	if len(b.pending) > 0 {
+		data = append(b.pending, data...)
+		b.pending = nil
+	}
+
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(data[:i]); len(line) > 0 {
+			lines = append(lines, line)
+		}
+		data = data[i+1:]
+	}
+
+	if rest := bytes.TrimSpace(data); objects && isObject(rest) {
+		lines = append(lines, rest)
+	} else if len(rest) > 0 {
+		b.pending = append([]byte(nil), data...)
+	}
+	return
+}
+
+func isObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{' && json.Valid(data)
+}
+
+func writeLine(line []byte, parser Parser, fn func(msg Message) error) error {
+	msg, err := parser.Parse(line)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", abbreviate(line), err)
+	}
+	return fn(msg)
+}
+
+func abbreviate(line []byte) string {
+	const limit = 64
+	if len(line) > limit {
+		return fmt.Sprintf("%q...", line[:limit])
+	}
+	return fmt.Sprintf("%q", line)
+}
@@ -0,0 +1,123 @@
+package sls
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineBuffer(t *testing.T) {
+	collect := func() (*[]Message, func(msg Message) error) {
+		var messages []Message
+		return &messages, func(msg Message) error {
+			messages = append(messages, msg)
+			return nil
+		}
+	}
+
+	t.Run("multiple lines", func(t *testing.T) {
+		b := &lineBuffer{}
+		messages, fn := collect()
+
+		assert.NoError(t, b.write([]byte("{\"no\":\"1\"}\n\n{\"no\":\"2\"}\r\n{\"no\":\"3\"}\n"), JSONParser{}, fn))
+		if assert.Len(t, *messages, 3) {
+			assert.Equal(t, "3", (*messages)[2].Contents["no"])
+		}
+		assert.Empty(t, b.pending)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		b := &lineBuffer{}
+		messages, fn := collect()
+
+		assert.NoError(t, b.write([]byte("{\"no\":\"1\"}\n{\"no\":"), JSONParser{}, fn))
+		assert.Len(t, *messages, 1)
+		assert.Equal(t, `{"no":`, string(b.pending))
+
+		assert.NoError(t, b.write([]byte(`"2"}`), JSONParser{}, fn))
+		if assert.Len(t, *messages, 2) {
+			assert.Equal(t, "2", (*messages)[1].Contents["no"])
+		}
+		assert.Empty(t, b.pending)
+	})
+
+	t.Run("single object", func(t *testing.T) {
+		b := &lineBuffer{}
+		messages, fn := collect()
+
+		assert.NoError(t, b.write([]byte("{\n  \"no\": \"1\"\n}"), JSONParser{}, fn))
+		assert.Len(t, *messages, 1)
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		b := &lineBuffer{}
+		messages, fn := collect()
+
+		err := b.write([]byte("{\"no\":\"1\"}\nnot json\n{\"no\":\"2\"}\n[1]\n"), JSONParser{}, fn)
+		assert.ErrorContains(t, err, `"not json"`)
+		assert.ErrorContains(t, err, `"[1]"`)
+		assert.Len(t, *messages, 2)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		b := &lineBuffer{}
+		_, fn := collect()
+
+		err := b.write([]byte(`{"msg":"`+strings.Repeat("x", MaxPendingSize)), JSONParser{}, fn)
+		assert.ErrorIs(t, err, ErrIncompleteLine)
+		assert.Empty(t, b.pending)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const writers = 4
+		b := &lineBuffer{}
+
+		// fn 等待所有 Write 都开始写入后才返回, 持有锁写入时会超时
+		var entered sync.WaitGroup
+		entered.Add(writers)
+		done := make(chan struct{})
+		go func() {
+			entered.Wait()
+			close(done)
+		}()
+		fn := func(msg Message) error {
+			entered.Done()
+			select {
+			case <-done:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("writes are serialized")
+			}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, b.write([]byte("{\"no\":\"1\"}\n"), JSONParser{}, fn))
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		b := &lineBuffer{}
+		messages, fn := collect()
+
+		assert.NoError(t, b.write([]byte(`{"no":`), JSONParser{}, fn))
+		assert.ErrorIs(t, b.flush(JSONParser{}, fn), ErrIncompleteLine)
+		assert.Empty(t, b.pending)
+		assert.NoError(t, b.flush(JSONParser{}, fn))
+
+		var nilBuffer *lineBuffer
+		assert.NoError(t, nilBuffer.flush(JSONParser{}, fn))
+		assert.ErrorIs(t, nilBuffer.write([]byte(`{"no":`), JSONParser{}, fn), ErrIncompleteLine)
+		assert.NoError(t, nilBuffer.write([]byte("{\"no\":\"1\"}\n{\"no\":\"2\"}"), JSONParser{}, fn))
+		assert.Len(t, *messages, 2)
+	})
+}
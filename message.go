@@ -3,34 +3,91 @@ package sls
 import (
 	"encoding/json"
 	"fmt"
-	"log/slog"
+	"maps"
+	"math"
+	"strings"
 	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
+// TagPrefix 为日志标签字段名的前缀, 如 "__tag__:pod" 字段在发送时作为 LogTag "pod" 写入
+const TagPrefix = "__tag__:"
+
 type Message struct {
 	Time     time.Time
 	Contents map[string]string
+	Tags     map[string]string // 日志标签, 标签相同的日志写入同一个 LogGroup
+}
+
+// splitTags 将 Contents 中以 TagPrefix 开头的字段移入标签, 依次合并 base, Tags 和这些字段
+func (msg Message) splitTags(base map[string]string) (Message, map[string]string) {
+	tags := make(map[string]string, len(base)+len(msg.Tags))
+	for k, v := range base {
+		tags[k] = v
+	}
+	for k, v := range msg.Tags {
+		tags[k] = v
+	}
+
+	var contents map[string]string
+	for k, v := range msg.Contents {
+		if key, ok := strings.CutPrefix(k, TagPrefix); ok {
+			if contents == nil {
+				contents = maps.Clone(msg.Contents)
+			}
+			tags[key] = v
+			delete(contents, k)
+		}
+	}
+	if contents != nil {
+		msg.Contents = contents
+	}
+	msg.Tags = nil
+	return msg, tags
+}
+
+// joinTags 将 Tags 以 TagPrefix 开头的字段写回 Contents, 用于本地缓存等只保存 Contents 的场景
+func (msg Message) joinTags() Message {
+	if len(msg.Tags) == 0 {
+		return msg
+	}
+	contents := make(map[string]string, len(msg.Contents)+len(msg.Tags))
+	for k, v := range msg.Tags {
+		contents[TagPrefix+k] = v
+	}
+	for k, v := range msg.Contents {
+		contents[k] = v
+	}
+	msg.Contents, msg.Tags = contents, nil
+	return msg
+}
+
+func (msg *Message) UnmarshalJSON(data []byte) error {
+	return msg.decode(data, nil, nil)
 }
 
-func (msg *Message) UnmarshalJSON(data []byte) (err error) {
+// decode 解析 JSON 格式的日志, 按 timeOpts 提取日志时间, flatten 不为空时展开嵌套的对象
+func (msg *Message) decode(data []byte, flatten *FlattenOptions, timeOpts *TimeOptions) (err error) {
 	var m map[string]json.RawMessage
 	if err = json.Unmarshal(data, &m); err != nil {
 		return
 	}
 
-	*msg = Message{
-		Time:     time.Now(),
-		Contents: make(map[string]string, len(m)),
-	}
+	*msg = Message{Contents: make(map[string]string, len(m))}
 
-	if raw, ok := m[slog.TimeKey]; ok {
-		if err = json.Unmarshal(raw, &msg.Time); err != nil {
-			return
-		}
-		delete(m, slog.TimeKey)
+	if msg.Time, err = extractTime(timeOpts, m, (*TimeOptions).parseJSON); err != nil {
+		return
 	}
 
 	for k, v := range m {
+		if flatten != nil {
+			if err = flatten.flatten(msg.Contents, k, v, 0); err != nil {
+				return
+			}
+			continue
+		}
+
 		var value string
 		if value, err = formatJsonValue(v); err != nil {
 			return
@@ -40,6 +97,16 @@ func (msg *Message) UnmarshalJSON(data []byte) (err error) {
 	return
 }
 
+// size 返回日志编码为 protobuf 后的近似字节数
+func (msg Message) size() int {
+	n := 1 + protowire.SizeVarint(math.MaxUint32) // Time
+	for k, v := range msg.Contents {
+		content := 2 + protowire.SizeBytes(len(k)) + protowire.SizeBytes(len(v))
+		n += 1 + protowire.SizeBytes(content)
+	}
+	return n
+}
+
 func formatJsonValue(input json.RawMessage) (output string, err error) {
 	// bool, for JSON booleans
 	// float64, for JSON numbers
@@ -3,10 +3,12 @@ package sls
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestMessage(t *testing.T) {
@@ -30,4 +32,31 @@ func TestMessage(t *testing.T) {
 			"arr":   `[1]`,
 		}, msg.Contents)
 	})
+
+	t.Run("size", func(t *testing.T) {
+		msg := Message{
+			Time: time.Now(),
+			Contents: map[string]string{
+				"level": "INFO",
+				"msg":   strings.Repeat("x", 200),
+			},
+		}
+		assert.Equal(t, proto.Size(encodeLog(msg, false)), msg.size())
+	})
+	t.Run("tags", func(t *testing.T) {
+		msg := Message{
+			Contents: map[string]string{"msg": "hello", TagPrefix + "pod": "b"},
+			Tags:     map[string]string{"pod": "a", "node": "n1"},
+		}
+
+		out, tags := msg.splitTags(map[string]string{"cluster": "prod", "node": "n0"})
+		assert.Equal(t, map[string]string{"msg": "hello"}, out.Contents)
+		assert.Nil(t, out.Tags)
+		assert.Equal(t, map[string]string{"cluster": "prod", "node": "n1", "pod": "b"}, tags)
+		assert.Contains(t, msg.Contents, TagPrefix+"pod")
+
+		joined := msg.joinTags()
+		assert.Equal(t, map[string]string{"msg": "hello", TagPrefix + "pod": "b", TagPrefix + "node": "n1"}, joined.Contents)
+		assert.Nil(t, joined.Tags)
+	})
 }
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// Publish 通过 expvar 以 name 发布 sources 的运行统计, 输出为每个 source 一项的数组.
+// 与 expvar.Publish 相同, name 重复时 panic.
+func Publish(name string, sources ...Source) {
+	expvar.Publish(name, Var(sources...))
+}
+
+// Var 返回输出 sources 运行统计的 expvar.Var, 可自行发布或嵌入到 expvar.Map 中
+func Var(sources ...Source) expvar.Var {
+	return expvar.Func(func() any {
+		out := make([]map[string]any, len(sources))
+		for i, source := range sources {
+			d, s := source.Destination(), source.Stats()
+			item := map[string]any{
+				"project":         d.Project,
+				"logstore":        d.Store,
+				"topic":           d.Topic,
+				"written":         s.Written,
+				"filtered":        s.Filtered,
+				"modified":        s.Modified,
+				"queued":          s.Queued,
+				"sent":            s.Sent,
+				"failed":          s.Failed,
+				"dropped":         s.Dropped,
+				"spooled":         s.Spooled,
+				"requests":        s.Requests,
+				"retried":         s.Retried,
+				"rawBytes":        s.RawBytes,
+				"compressedBytes": s.CompressedBytes,
+				"queueDepth":      s.QueueDepth,
+			}
+			if s.LastError != nil {
+				item["lastError"] = s.LastError.Error()
+				item["lastErrorTime"] = s.LastErrorTime.Format(time.RFC3339Nano)
+			}
+			if !s.LastSuccessTime.IsZero() {
+				item["lastSuccessTime"] = s.LastSuccessTime.Format(time.RFC3339Nano)
+			}
+			out[i] = item
+		}
+		return out
+	})
+}
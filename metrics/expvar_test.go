@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVar(t *testing.T) {
+	var out []map[string]any
+	if assert.NoError(t, json.Unmarshal([]byte(Var(sources...).String()), &out)) && assert.Len(t, out, 2) {
+		assert.Equal(t, "store", out[0]["logstore"])
+		assert.EqualValues(t, 8, out[0]["sent"])
+		assert.Equal(t, "test error", out[0]["lastError"])
+		assert.NotContains(t, out[1], "lastError")
+		assert.NotContains(t, out[1], "lastSuccessTime")
+	}
+}
+
+// published 使 go test -count=N 重复执行时每次发布的名称不同, expvar 不允许重复发布同一名称
+var published atomic.Int32
+
+func TestPublish(t *testing.T) {
+	name := fmt.Sprintf("sls_test_%d", published.Add(1))
+	Publish(name, sources...)
+
+	v := expvar.Get(name)
+	if assert.NotNil(t, v) {
+		assert.JSONEq(t, Var(sources...).String(), v.String())
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sls "github.com/gota33/aliyun-log-writer"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Source 为提供运行统计的日志写入器, *sls.Writer 实现了该接口
+type Source interface {
+	Stats() sls.Stats
+	Destination() sls.Destination
+}
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(s sls.Stats) float64
+}
+
+func counter(name, help string, value func(s sls.Stats) int64) metric {
+	return metric{
+		name:  "sls_writer_" + name + "_total",
+		kind:  "counter",
+		help:  help,
+		value: func(s sls.Stats) float64 { return float64(value(s)) },
+	}
+}
+
+func timestamp(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+var metrics = []metric{
+	counter("messages_written", "Messages written to the writer.", func(s sls.Stats) int64 { return s.Written }),
+	counter("messages_filtered", "Messages rejected by the message filter.", func(s sls.Stats) int64 { return s.Filtered }),
+	counter("messages_modified", "Messages passed through the message modifier.", func(s sls.Stats) int64 { return s.Modified }),
+	counter("messages_queued", "Messages accepted into the send buffer.", func(s sls.Stats) int64 { return s.Queued }),
+	counter("messages_sent", "Messages delivered to SLS.", func(s sls.Stats) int64 { return s.Sent }),
+	counter("messages_failed", "Messages that failed to be delivered.", func(s sls.Stats) int64 { return s.Failed }),
+	counter("messages_dropped", "Messages dropped because the send buffer was full.", func(s sls.Stats) int64 { return s.Dropped }),
+	counter("messages_spooled", "Messages written to the local spool after a failed send.", func(s sls.Stats) int64 { return s.Spooled }),
+	counter("requests", "PutLogs requests, including retries.", func(s sls.Stats) int64 { return s.Requests }),
+	counter("retries", "PutLogs requests that were retries.", func(s sls.Stats) int64 { return s.Retried }),
+	counter("raw_bytes", "Encoded LogGroup bytes delivered.", func(s sls.Stats) int64 { return s.RawBytes }),
+	counter("compressed_bytes", "Compressed request body bytes delivered.", func(s sls.Stats) int64 { return s.CompressedBytes }),
+	{
+		name:  "sls_writer_queue_depth",
+		kind:  "gauge",
+		help:  "Messages accepted but not yet delivered.",
+		value: func(s sls.Stats) float64 { return float64(s.QueueDepth) },
+	},
+	{
+		name:  "sls_writer_last_error_timestamp_seconds",
+		kind:  "gauge",
+		help:  "Unix time of the last reported error.",
+		value: func(s sls.Stats) float64 { return timestamp(s.LastErrorTime) },
+	},
+	{
+		name:  "sls_writer_last_success_timestamp_seconds",
+		kind:  "gauge",
+		help:  "Unix time of the last successful delivery.",
+		value: func(s sls.Stats) float64 { return timestamp(s.LastSuccessTime) },
+	},
+}
+
+// Handler 返回以 Prometheus 文本格式输出 sources 运行统计的 http.Handler,
+// 每个 source 以 project, logstore 和 topic 作为标签.
+func Handler(sources ...Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_ = WriteText(w, sources...)
+	})
+}
+
+// WriteText 以 Prometheus 文本格式输出 sources 的运行统计
+func WriteText(w io.Writer, sources ...Source) error {
+	stats := make([]sls.Stats, len(sources))
+	labels := make([]string, len(sources))
+	for i, source := range sources {
+		stats[i] = source.Stats()
+		labels[i] = formatLabels(source.Destination())
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		bw.WriteString("# HELP " + m.name + " " + m.help + "\n")
+		bw.WriteString("# TYPE " + m.name + " " + m.kind + "\n")
+		for i := range sources {
+			bw.WriteString(m.name + labels[i] + " ")
+			bw.WriteString(strconv.FormatFloat(m.value(stats[i]), 'g', -1, 64))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(d sls.Destination) string {
+	return `{project="` + labelReplacer.Replace(d.Project) +
+		`",logstore="` + labelReplacer.Replace(d.Store) +
+		`",topic="` + labelReplacer.Replace(d.Topic) + `"}`
+}
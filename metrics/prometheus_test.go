@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSource struct {
+	stats       sls.Stats
+	destination sls.Destination
+}
+
+func (s mockSource) Stats() sls.Stats             { return s.stats }
+func (s mockSource) Destination() sls.Destination { return s.destination }
+
+var sources = []Source{
+	mockSource{
+		stats: sls.Stats{
+			Written:       10,
+			Sent:          8,
+			Failed:        2,
+			QueueDepth:    3,
+			LastError:     errors.New("test error"),
+			LastErrorTime: time.Unix(1700000000, 500000000),
+		},
+		destination: sls.Destination{Project: "project", Store: "store", Topic: "topic"},
+	},
+	mockSource{
+		destination: sls.Destination{Project: "project", Store: "audit", Topic: `a"b\c`},
+	},
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(Handler(sources...))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+
+	body := string(data)
+	assert.Contains(t, body, "# TYPE sls_writer_messages_sent_total counter\n")
+	assert.Contains(t, body, `sls_writer_messages_written_total{project="project",logstore="store",topic="topic"} 10`+"\n")
+	assert.Contains(t, body, `sls_writer_messages_sent_total{project="project",logstore="store",topic="topic"} 8`+"\n")
+	assert.Contains(t, body, `sls_writer_queue_depth{project="project",logstore="store",topic="topic"} 3`+"\n")
+	assert.Contains(t, body, `sls_writer_last_error_timestamp_seconds{project="project",logstore="store",topic="topic"} 1.7000000005e+09`+"\n")
+	assert.Contains(t, body, `sls_writer_messages_sent_total{project="project",logstore="audit",topic="a\"b\\c"} 0`+"\n")
+	assert.Equal(t, 1, strings.Count(body, "# TYPE sls_writer_messages_sent_total"))
+}
@@ -0,0 +1,50 @@
+package modifiers
+
+import (
+	"regexp"
+
+	sls "github.com/gota33/aliyun-log-writer"
+)
+
+// Extract 用正则表达式的命名分组从 Field 字段中提取新字段, 类似 Logtail 的正则解析,
+// 如将反向代理的访问日志拆分为可查询的字段. Patterns 依次尝试, 使用第一个匹配的,
+// 其中匹配到内容的命名分组作为同名字段写入并覆盖已有的字段, 均不匹配时日志保持不变.
+type Extract struct {
+	Field    string           // 源字段名, 如 "msg" 或 "content"
+	Patterns []*regexp.Regexp // 依次尝试的正则表达式
+	Drop     bool             // 匹配时是否删除源字段, 默认保留
+}
+
+func (m *Extract) Modify(msg sls.Message) sls.Message {
+	value, ok := msg.Contents[m.Field]
+	if !ok {
+		return msg
+	}
+
+	for _, pattern := range m.Patterns {
+		match := pattern.FindStringSubmatchIndex(value)
+		if match == nil {
+			continue
+		}
+
+		if m.Drop {
+			delete(msg.Contents, m.Field)
+		}
+		for i, name := range pattern.SubexpNames() {
+			if name != "" && match[2*i] >= 0 {
+				msg.Contents[name] = value[match[2*i]:match[2*i+1]]
+			}
+		}
+		break
+	}
+	return msg
+}
+
+// ExtractFields 返回用 patterns 从 field 字段中提取新字段并保留源字段的 Extract, patterns 无效时 panic
+func ExtractFields(field string, patterns ...string) sls.MessageModifier {
+	m := &Extract{Field: field}
+	for _, pattern := range patterns {
+		m.Patterns = append(m.Patterns, regexp.MustCompile(pattern))
+	}
+	return m
+}
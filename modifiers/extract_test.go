@@ -0,0 +1,50 @@
+package modifiers
+
+import (
+	"regexp"
+	"testing"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	const line = `10.0.0.1 - - [15/Nov/2023:06:13:20 +0800] "GET /api/users?id=1 HTTP/1.1" 200 512`
+
+	m := ExtractFields("content",
+		`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time_local>[^]]+)\] "(?P<method>\S+) (?P<uri>\S+) \S+" (?P<status>\d{3}) (?P<body_bytes>\d+)(?: "(?P<referer>[^"]*)")?$`,
+		`^(?P<status>\d{3}) (?P<uri>\S+)$`,
+	)
+
+	output := m.Modify(sls.Message{Contents: map[string]string{"content": line, "status": "0"}})
+	assert.Equal(t, map[string]string{
+		"content":     line,
+		"remote_addr": "10.0.0.1",
+		"remote_user": "-",
+		"time_local":  "15/Nov/2023:06:13:20 +0800",
+		"method":      "GET",
+		"uri":         "/api/users?id=1",
+		"status":      "200",
+		"body_bytes":  "512",
+	}, output.Contents)
+
+	output = m.Modify(sls.Message{Contents: map[string]string{"content": "404 /missing"}})
+	assert.Equal(t, map[string]string{"content": "404 /missing", "status": "404", "uri": "/missing"}, output.Contents)
+
+	output = m.Modify(sls.Message{Contents: map[string]string{"content": "not matched"}})
+	assert.Equal(t, map[string]string{"content": "not matched"}, output.Contents)
+
+	output = m.Modify(sls.Message{Contents: map[string]string{"msg": "404 /missing"}})
+	assert.Equal(t, map[string]string{"msg": "404 /missing"}, output.Contents)
+
+	m = &Extract{
+		Field:    "msg",
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`^(?P<level>[A-Z]+): (?P<msg>.*)$`)},
+		Drop:     true,
+	}
+	output = m.Modify(sls.Message{Contents: map[string]string{"msg": "WARN: disk full"}})
+	assert.Equal(t, map[string]string{"level": "WARN", "msg": "disk full"}, output.Contents)
+
+	output = m.Modify(sls.Message{Contents: map[string]string{"msg": "plain"}})
+	assert.Equal(t, map[string]string{"msg": "plain"}, output.Contents)
+}
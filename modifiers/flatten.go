@@ -0,0 +1,17 @@
+package modifiers
+
+import sls "github.com/gota33/aliyun-log-writer"
+
+// Flatten 将值为 JSON 对象的字段展开为 "parent.child" 形式的字段,
+// 适用于 slog.NewJSONHandler 以外的来源, 如 sls.NewHandler 中以 slog.Any 记录的 map 或结构体.
+type Flatten struct {
+	Options sls.FlattenOptions
+}
+
+func (m *Flatten) Modify(msg sls.Message) sls.Message {
+	return m.Options.Flatten(msg)
+}
+
+func FlattenFields() sls.MessageModifier {
+	return &Flatten{}
+}
@@ -0,0 +1,32 @@
+package modifiers
+
+import (
+	"testing"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatten(t *testing.T) {
+	m := FlattenFields()
+
+	output := m.Modify(sls.Message{
+		Contents: map[string]string{
+			"msg":  "hello",
+			"user": `{"id":1,"name":"test","tags":["a","b"]}`,
+			"text": "{not json",
+		},
+	})
+
+	assert.Equal(t, map[string]string{
+		"msg":       "hello",
+		"user.id":   "1",
+		"user.name": "test",
+		"user.tags": `["a","b"]`,
+		"text":      "{not json",
+	}, output.Contents)
+
+	m = &Flatten{Options: sls.FlattenOptions{Separator: "_", Arrays: sls.ArrayIndex}}
+	output = m.Modify(sls.Message{Contents: map[string]string{"arr": `[1,{"a":true}]`}})
+	assert.Equal(t, map[string]string{"arr_0": "1", "arr_1_a": "true"}, output.Contents)
+}
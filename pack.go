@@ -0,0 +1,49 @@
+package sls
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gota33/aliyun-log-writer/api"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// PackIDTag 为 SLS 上下文浏览所使用的 LogTag, 值为 "<前缀>-<批次序号>",
+// 同一前缀下序号连续的 LogGroup 被视为同一来源的上下文.
+const PackIDTag = "__pack_id__"
+
+// packIDGenerator 与 Logtail 及官方 Producer 一致, 以进程唯一的 16 位十六进制前缀加递增的十六进制序号生成 pack id
+type packIDGenerator struct {
+	prefix string
+	seq    atomic.Uint64
+}
+
+func newPackIDGenerator() *packIDGenerator {
+	hostname, _ := os.Hostname()
+	sum := md5.Sum([]byte(fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())))
+	return &packIDGenerator{prefix: strings.ToUpper(hex.EncodeToString(sum[:8]))}
+}
+
+func (g *packIDGenerator) next() string {
+	return g.prefix + "-" + strings.ToUpper(strconv.FormatUint(g.seq.Add(1)-1, 16))
+}
+
+func (g *packIDGenerator) tag() *api.LogTag {
+	return &api.LogTag{Key: proto.String(PackIDTag), Value: proto.String(g.next())}
+}
+
+// maxTagSize 返回 pack id 标签在 LogGroup 中占用的最大字节数
+func (g *packIDGenerator) maxTagSize() int {
+	tag := &api.LogTag{
+		Key:   proto.String(PackIDTag),
+		Value: proto.String(g.prefix + "-" + strings.Repeat("F", 16)),
+	}
+	return protowire.SizeTag(6) + protowire.SizeBytes(proto.Size(tag))
+}
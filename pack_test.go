@@ -0,0 +1,58 @@
+package sls
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPackID(t *testing.T) {
+	t.Run("next", func(t *testing.T) {
+		g := newPackIDGenerator()
+		assert.Regexp(t, `^[0-9A-F]{16}$`, g.prefix)
+		assert.NotEqual(t, g.prefix, newPackIDGenerator().prefix)
+
+		for i := 0; i < 12; i++ {
+			assert.Equal(t, fmt.Sprintf("%s-%X", g.prefix, i), g.next())
+		}
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		g := newPackIDGenerator()
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource, packID: g}
+
+		messages := makeMessages(MaxLogGroupCount + 1)
+		messages = append(messages, Message{Contents: map[string]string{"no": "x"}, Tags: map[string]string{"pod": "a"}})
+
+		groups, _, err := w.encode(messages...)
+		if !assert.NoError(t, err) || !assert.Len(t, groups, 3) {
+			return
+		}
+		for i, encoded := range groups {
+			group := decodeGroup(t, encoded.raw)
+			tags := group.GetLogTags()
+			if assert.NotEmpty(t, tags) {
+				last := tags[len(tags)-1]
+				assert.Equal(t, PackIDTag, last.GetKey())
+				assert.Equal(t, fmt.Sprintf("%s-%X", g.prefix, i), last.GetValue())
+			}
+			assert.LessOrEqual(t, len(encoded.raw), MaxLogGroupSize)
+		}
+		assert.Equal(t, "pod", decodeGroup(t, groups[2].raw).GetLogTags()[0].GetKey())
+	})
+
+	t.Run("max tag size", func(t *testing.T) {
+		g := newPackIDGenerator()
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource}
+		groups, _, _ := w.encode(makeMessages(1)...)
+		size := len(groups[0].raw)
+
+		w.packID = g
+		g.seq.Store(1<<64 - 1)
+		groups, _, _ = w.encode(makeMessages(1)...)
+		assert.Equal(t, g.maxTagSize(), len(groups[0].raw)-size)
+		assert.Equal(t, proto.Size(decodeGroup(t, groups[0].raw)), len(groups[0].raw))
+	})
+}
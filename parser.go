@@ -0,0 +1,142 @@
+package sls
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultRawKey 为 RawParser 写入整行文本的默认字段名
+const DefaultRawKey = "content"
+
+var ErrInvalidLogfmt = errors.New("invalid logfmt")
+
+// Parser 将 Write 写入的一行数据解析为日志
+type Parser interface {
+	Parse(line []byte) (Message, error)
+}
+
+type ParserFunc func(line []byte) (Message, error)
+
+func (f ParserFunc) Parse(line []byte) (Message, error) { return f(line) }
+
+// JSONParser 解析 JSON 格式的日志, 如 slog.NewJSONHandler, zap, zerolog 的输出
+type JSONParser struct {
+	Flatten *FlattenOptions // 将嵌套的对象展开为 "parent.child" 形式的字段, 可选, 默认为空不展开
+	Time    *TimeOptions    // 提取日志时间的字段名, 格式及时区, 可选
+}
+
+func (p JSONParser) Parse(line []byte) (msg Message, err error) {
+	err = msg.decode(line, p.Flatten, p.Time)
+	return
+}
+
+// isJSON 判断 parser 是否解析 JSON, 此时完整的 JSON 对象无需以换行结尾
+func isJSON(parser Parser) bool {
+	switch parser.(type) {
+	case JSONParser, *JSONParser:
+		return true
+	default:
+		return false
+	}
+}
+
+// LogfmtParser 解析 logfmt 格式的日志, 如 slog.NewTextHandler 的输出:
+//
+//	time=2023-11-15T06:13:20.000+08:00 level=INFO msg="hello world" user.id=1
+//
+// 以双引号包围的键和值按 Go 字符串字面量解析, 没有 "=" 的键的值为空字符串.
+type LogfmtParser struct {
+	Time *TimeOptions // 提取日志时间的字段名, 格式及时区, 可选
+}
+
+func (p LogfmtParser) Parse(line []byte) (msg Message, err error) {
+	contents := make(map[string]string)
+	for s := strings.TrimSpace(string(line)); s != ""; s = strings.TrimLeft(s, " \t") {
+		var key, value string
+		if key, s, err = logfmtToken(s, true); err != nil {
+			return
+		}
+		if key == "" {
+			return msg, fmt.Errorf("%w: missing key before %q", ErrInvalidLogfmt, s)
+		}
+		if rest, ok := strings.CutPrefix(s, "="); ok {
+			if value, s, err = logfmtToken(rest, false); err != nil {
+				return
+			}
+		}
+		contents[key] = value
+	}
+
+	if msg.Time, err = extractTime(p.Time, contents, (*TimeOptions).Parse); err != nil {
+		return
+	}
+	msg.Contents = contents
+	return
+}
+
+// logfmtToken 读取 s 开头的键或值, 返回其余部分
+func logfmtToken(s string, key bool) (token, rest string, err error) {
+	end := " \t"
+	if key {
+		end += "="
+	}
+
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, end)
+		if i < 0 {
+			i = len(s)
+		}
+		return s[:i], s[i:], nil
+	}
+
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", s, fmt.Errorf("%w: %v in %q", ErrInvalidLogfmt, err, s)
+	}
+	if token, err = strconv.Unquote(quoted); err != nil {
+		return "", s, fmt.Errorf("%w: %v in %q", ErrInvalidLogfmt, err, quoted)
+	}
+	if rest = s[len(quoted):]; rest != "" && !strings.ContainsRune(end, rune(rest[0])) {
+		return "", s, fmt.Errorf("%w: unexpected %q after %s", ErrInvalidLogfmt, rest[0], quoted)
+	}
+	return
+}
+
+// RawParser 将整行文本写入 Key 字段, 适用于标准库 log 包等输出的非结构化日志.
+// Pattern 不为空且匹配时, 其中匹配到内容的命名分组作为同名字段写入, 如:
+//
+//	regexp.MustCompile(`^(?P<time>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (?P<message>.*)$`)
+type RawParser struct {
+	Key     string         // 写入整行文本的字段名, 可选, 默认为 "content"
+	Pattern *regexp.Regexp // 提取字段的正则表达式, 可选, 默认为空不提取
+	Time    *TimeOptions   // 从提取的字段中获取日志时间的字段名, 格式及时区, 可选, 未提取到时使用当前时间
+}
+
+func (p RawParser) Parse(line []byte) (msg Message, err error) {
+	key := p.Key
+	if key == "" {
+		key = DefaultRawKey
+	}
+
+	text := string(line)
+	contents := map[string]string{key: text}
+
+	if p.Pattern != nil {
+		if match := p.Pattern.FindStringSubmatchIndex(text); match != nil {
+			for i, name := range p.Pattern.SubexpNames() {
+				if name != "" && match[2*i] >= 0 {
+					contents[name] = text[match[2*i]:match[2*i+1]]
+				}
+			}
+		}
+	}
+
+	if msg.Time, err = extractTime(p.Time, contents, (*TimeOptions).Parse); err != nil {
+		return
+	}
+	msg.Contents = contents
+	return
+}
@@ -0,0 +1,107 @@
+package sls
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	t.Run("slog text handler", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+		logger.Info("hello world", "user", slog.GroupValue(slog.Int("id", 1)), "quote", `say "hi"`, "empty", "")
+
+		msg, err := LogfmtParser{}.Parse(bytes.TrimSpace(buf.Bytes()))
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), msg.Time, time.Second)
+		assert.Equal(t, map[string]string{
+			"level":   "INFO",
+			"msg":     "hello world",
+			"user.id": "1",
+			"quote":   `say "hi"`,
+			"empty":   "",
+		}, msg.Contents)
+	})
+
+	t.Run("syntax", func(t *testing.T) {
+		msg, err := LogfmtParser{}.Parse([]byte(` a=1  b  "c d"="e\tf" g= `))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "b": "", "c d": "e\tf", "g": ""}, msg.Contents)
+	})
+
+	t.Run("time", func(t *testing.T) {
+		msg, err := LogfmtParser{Time: &TimeOptions{Keys: []string{"ts"}}}.Parse([]byte(`ts=1700000000 msg=hi`))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1700000000), msg.Time.Unix())
+		assert.Equal(t, map[string]string{"msg": "hi"}, msg.Contents)
+
+		_, err = LogfmtParser{}.Parse([]byte(`time=yesterday msg=hi`))
+		assert.ErrorIs(t, err, ErrInvalidTime)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, line := range []string{`=1`, `a="1`, `a="1"b`, `a="\q"`} {
+			_, err := LogfmtParser{}.Parse([]byte(line))
+			assert.ErrorIs(t, err, ErrInvalidLogfmt, line)
+		}
+	})
+}
+
+func TestRawParser(t *testing.T) {
+	var buf bytes.Buffer
+	log.New(&buf, "", log.LstdFlags).Print("hello world")
+	line := bytes.TrimSpace(buf.Bytes())
+
+	t.Run("default", func(t *testing.T) {
+		msg, err := RawParser{}.Parse(line)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), msg.Time, time.Second)
+		assert.Equal(t, map[string]string{DefaultRawKey: string(line)}, msg.Contents)
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		p := RawParser{
+			Key:     "line",
+			Pattern: regexp.MustCompile(`^(?P<time>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (?:(?P<level>[A-Z]+): )?(?P<message>.*)$`),
+			Time:    &TimeOptions{Layouts: []string{"2006/01/02 15:04:05"}, Location: time.Local},
+		}
+		msg, err := p.Parse(line)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), msg.Time, 2*time.Second)
+		assert.Equal(t, map[string]string{"line": string(line), "message": "hello world"}, msg.Contents)
+
+		msg, err = p.Parse([]byte("not matched"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"line": "not matched"}, msg.Contents)
+	})
+}
+
+func TestParserLines(t *testing.T) {
+	var messages []Message
+	fn := func(msg Message) error {
+		messages = append(messages, msg)
+		return nil
+	}
+
+	b := &lineBuffer{}
+	assert.NoError(t, b.write([]byte("a=1\n{\"b\":2}"), LogfmtParser{}, fn))
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `{"b":2}`, string(b.pending))
+	assert.NoError(t, b.write([]byte(` c="d`), LogfmtParser{}, fn))
+	assert.ErrorIs(t, b.flush(LogfmtParser{}, fn), ErrInvalidLogfmt)
+
+	assert.NoError(t, b.write([]byte("first line\nsecond"), RawParser{}, fn))
+	assert.NoError(t, b.write([]byte(" line"), RawParser{}, fn))
+	assert.NoError(t, b.flush(RawParser{}, fn))
+	if assert.Len(t, messages, 3) {
+		assert.Equal(t, "first line", messages[1].Contents[DefaultRawKey])
+		assert.Equal(t, "second line", messages[2].Contents[DefaultRawKey])
+	}
+}
@@ -0,0 +1,146 @@
+package sls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultMaxElapsed     = 30 * time.Second
+)
+
+// retryableCodes 为 PutLogs 返回的可重试错误码,
+// 参考: https://help.aliyun.com/document_detail/29026.html
+var retryableCodes = map[string]bool{
+	"ServerBusy":            true,
+	"InternalServerError":   true,
+	"RequestTimeout":        true,
+	"WriteQuotaExceed":      true,
+	"ShardWriteQuotaExceed": true,
+	"ExceedQuota":           true,
+}
+
+type RetryPolicy struct {
+	MaxAttempts    int                  // 最大尝试次数 (含首次发送), 可选, 默认为 3, 设为 1 时不重试
+	InitialBackoff time.Duration        // 首次重试前的等待时间, 之后每次翻倍, 可选, 默认为 200ms
+	MaxBackoff     time.Duration        // 单次重试等待时间上限, 可选, 默认为 5s
+	MaxElapsed     time.Duration        // 单批日志重试总耗时上限, 可选, 默认为 30s
+	Retryable      func(err error) bool // 判断错误是否可重试, 可选, 默认为 IsRetryable
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.MaxElapsed <= 0 {
+		p.MaxElapsed = DefaultMaxElapsed
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	return p
+}
+
+// do 执行 fn 直到成功, 遇到不可重试的错误, 或超出尝试次数/总耗时上限.
+// 零值 RetryPolicy 只执行一次 fn.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) (err error) {
+	start := time.Now()
+	backoff := p.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("give up after %d attempts: %w", attempt, err)
+			}
+			return
+		}
+
+		wait := jitter(backoff)
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return fmt.Errorf("give up after %d attempts: %w", attempt, err)
+		}
+		logger.Printf("Retry[%d] after %s: %v", attempt, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("give up after %d attempts: %w", attempt, err)
+		case <-timer.C:
+		}
+
+		if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// jitter 返回 [d/2, d] 之间的随机时长, 避免多个实例同时重试
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// IsRetryable 判断发送日志时产生的错误是否可以重试.
+// 服务端限流, 服务端错误, 以及连接中断/超时等网络错误可以重试;
+// 鉴权失败, 参数错误等其他错误重试也不会成功.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var aErr *AliyunError
+	if errors.As(err, &aErr) {
+		return retryableCodes[aErr.Code] ||
+			aErr.HTTPCode >= http.StatusInternalServerError ||
+			aErr.HTTPCode == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
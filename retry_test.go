@@ -0,0 +1,143 @@
+package sls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{&AliyunError{HTTPCode: http.StatusServiceUnavailable, Code: "ServerBusy"}, true},
+		{&AliyunError{HTTPCode: http.StatusForbidden, Code: "WriteQuotaExceed"}, true},
+		{&AliyunError{HTTPCode: http.StatusForbidden, Code: "ShardWriteQuotaExceed"}, true},
+		{&AliyunError{HTTPCode: http.StatusBadGateway}, true},
+		{&AliyunError{HTTPCode: http.StatusTooManyRequests}, true},
+		{&AliyunError{HTTPCode: http.StatusUnauthorized, Code: "Unauthorized"}, false},
+		{&AliyunError{HTTPCode: http.StatusRequestEntityTooLarge, Code: "PostBodyTooLarge"}, false},
+		{fmt.Errorf("wrapped: %w", &AliyunError{HTTPCode: http.StatusInternalServerError}), true},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, true},
+		{io.ErrUnexpectedEOF, true},
+		{syscall.ECONNRESET, true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{errors.New("unknown"), false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.retryable, IsRetryable(c.err), "%v", c.err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	retryable := &AliyunError{HTTPCode: http.StatusServiceUnavailable, Code: "ServerBusy"}
+	fatal := &AliyunError{HTTPCode: http.StatusUnauthorized, Code: "Unauthorized"}
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		MaxElapsed:     time.Second,
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		count := 0
+		err := RetryPolicy{}.do(context.Background(), func() error { count++; return retryable })
+		assert.ErrorIs(t, err, retryable)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		p := RetryPolicy{}.withDefaults()
+		assert.Equal(t, DefaultMaxAttempts, p.MaxAttempts)
+		assert.Equal(t, DefaultInitialBackoff, p.InitialBackoff)
+		assert.Equal(t, DefaultMaxBackoff, p.MaxBackoff)
+		assert.Equal(t, DefaultMaxElapsed, p.MaxElapsed)
+		assert.NotNil(t, p.Retryable)
+	})
+
+	t.Run("success after retry", func(t *testing.T) {
+		count := 0
+		err := policy.do(context.Background(), func() error {
+			if count++; count < 3 {
+				return retryable
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		count := 0
+		err := policy.do(context.Background(), func() error { count++; return retryable })
+		assert.ErrorIs(t, err, retryable)
+		assert.Equal(t, policy.MaxAttempts, count)
+	})
+
+	t.Run("fatal", func(t *testing.T) {
+		count := 0
+		err := policy.do(context.Background(), func() error { count++; return fatal })
+		assert.Equal(t, fatal, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("max elapsed", func(t *testing.T) {
+		p := policy
+		p.MaxAttempts = 100
+		p.InitialBackoff = 20 * time.Millisecond
+		p.MaxBackoff = 20 * time.Millisecond
+		p.MaxElapsed = 50 * time.Millisecond
+
+		count := 0
+		err := p.do(context.Background(), func() error { count++; return retryable })
+		assert.ErrorIs(t, err, retryable)
+		assert.Less(t, count, 5)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		p := policy
+		p.InitialBackoff = time.Hour
+		p.MaxBackoff = time.Hour
+		p.MaxElapsed = 2 * time.Hour
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		count := 0
+		err := p.do(ctx, func() error { count++; return retryable })
+		assert.ErrorIs(t, err, retryable)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("custom retryable", func(t *testing.T) {
+		p := policy
+		p.Retryable = func(err error) bool { return true }
+
+		count := 0
+		err := p.do(context.Background(), func() error { count++; return fatal })
+		assert.ErrorIs(t, err, fatal)
+		assert.Equal(t, p.MaxAttempts, count)
+	})
+}
+
+func TestJitter(t *testing.T) {
+	assert.Zero(t, jitter(0))
+	for i := 0; i < 100; i++ {
+		d := jitter(10 * time.Millisecond)
+		assert.GreaterOrEqual(t, d, 5*time.Millisecond)
+		assert.LessOrEqual(t, d, 10*time.Millisecond)
+	}
+}
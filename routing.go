@@ -0,0 +1,316 @@
+package sls
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gota33/aliyun-log-writer/internal/validator"
+)
+
+// DefaultMaxDestinations 为 RoutingWriter 默认最多写入的目标数量
+const DefaultMaxDestinations = 64
+
+var (
+	ErrInvalidDestination  = errors.New("invalid destination")
+	ErrTooManyDestinations = errors.New("too many destinations")
+)
+
+// SLS 的命名规则: 3~63 个字符, 只能包含小写字母, 数字和短划线 (Logstore 还可以包含下划线), 以小写字母或数字开头和结尾
+var (
+	projectPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+	storePattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,61}[a-z0-9]$`)
+)
+
+// Router 为每条日志选择写入目标, 返回值中为空的字段使用 Config 中的 Project, Store 和 Topic.
+// 返回的 Project 或 Store 不符合 SLS 命名规则时, 写入该日志返回 ErrInvalidDestination.
+type Router interface {
+	Route(msg Message) Destination
+}
+
+type RouterFunc func(msg Message) Destination
+
+func (f RouterFunc) Route(msg Message) Destination { return f(msg) }
+
+// FieldRouter 以日志中 field 字段的值作为 logstore, 字段不存在或为空时写入 Config.Store.
+// 字段值来自日志内容, 可以配合 Config.MaxDestinations 限制目标数量.
+func FieldRouter(field string) Router {
+	return RouterFunc(func(msg Message) Destination {
+		return Destination{Store: msg.Contents[field]}
+	})
+}
+
+// RoutingWriter 根据日志内容将日志写入不同的 Project, Store 和 Topic,
+// 每个目标由独立的 Writer 分别缓存和批量发送, 共用同一个 HTTP 客户端和访问凭证.
+type RoutingWriter struct {
+	config   Config
+	router   Router
+	filter   MessageFilter
+	modifier MessageModifier
+	mu       sync.RWMutex
+	writers  map[Destination]*Writer
+	limit    int
+	lines    *lineBuffer
+	parser   Parser
+	closed   bool
+}
+
+// NewRoutingWriter 创建按 router 选择写入目标的 RoutingWriter, c 中的 Project, Store 和 Topic 为默认目标.
+// 各目标的 Writer 在首次写入时创建并保留到 Shutdown, 数量不超过 c.MaxDestinations.
+// 启用 SpoolDir 时每个目标使用其下独立的子目录, 并立即为其中仍有待重发日志的目标创建 Writer 开始重发,
+// 无法恢复的子目录通过 c.OnError 报告.
+func NewRoutingWriter(c Config, router Router) (writer *RoutingWriter, err error) {
+	if router == nil {
+		return nil, validator.IllegalArgument("Router", "is required")
+	}
+	if err = c.validate(); err != nil {
+		return
+	}
+
+	writer = &RoutingWriter{
+		config:   c,
+		router:   router,
+		filter:   c.MessageFilter,
+		modifier: c.MessageModifier,
+		writers:  make(map[Destination]*Writer),
+		limit:    validator.Coalesce(c.MaxDestinations, DefaultMaxDestinations),
+		lines:    &lineBuffer{},
+		parser:   c.parser(),
+	}
+
+	if c.SpoolDir != "" {
+		if rErr := writer.restore(); rErr != nil {
+			logger.Printf("Restore: %v", rErr)
+			if c.OnError != nil {
+				c.OnError(rErr)
+			}
+		}
+	}
+	return
+}
+
+// restore 为 SpoolDir 中仍有待重发日志的目标创建 Writer, 避免不再出现的目标的日志一直留在本地缓存中
+func (w *RoutingWriter) restore() error {
+	base := w.config.SpoolDir
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("restore spool %q: %w", base, err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		dir := filepath.Join(base, entry.Name())
+		if !entry.IsDir() || !hasSegments(dir) {
+			continue
+		}
+
+		d, err := readDestination(dir)
+		if err == nil && spoolDir(base, d) != dir {
+			err = fmt.Errorf("%w: %+v does not match directory", ErrInvalidDestination, d)
+		}
+		if err == nil {
+			_, err = w.writer(d)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore spool %q: %w", dir, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Write 与 Writer.Write 相同, 写入换行分隔的日志
+func (w *RoutingWriter) Write(data []byte) (n int, err error) {
+	return len(data), w.lines.write(data, w.parser, w.WriteMessage)
+}
+
+// WriteMessage 写入已解析的日志, 经过 MessageFilter 和 MessageModifier 处理后由 Router 选择写入目标
+func (w *RoutingWriter) WriteMessage(msg Message) error {
+	if w.filter == nil || !w.filter.Filter(msg) {
+		return nil
+	}
+
+	if w.modifier != nil {
+		msg = w.modifier.Modify(msg)
+	}
+
+	d, err := w.destination(msg)
+	if err != nil {
+		return err
+	}
+	writer, err := w.writer(d)
+	if err != nil {
+		return err
+	}
+	return writer.WriteMessage(msg)
+}
+
+func (w *RoutingWriter) destination(msg Message) (d Destination, err error) {
+	d = w.router.Route(msg)
+	if d.Project == "" {
+		d.Project = w.config.Project
+	} else if !projectPattern.MatchString(d.Project) {
+		return d, fmt.Errorf("%w: project %q", ErrInvalidDestination, d.Project)
+	}
+	if d.Store == "" {
+		d.Store = w.config.Store
+	} else if !storePattern.MatchString(d.Store) {
+		return d, fmt.Errorf("%w: store %q", ErrInvalidDestination, d.Store)
+	}
+	if d.Topic == "" {
+		d.Topic = w.config.Topic
+	}
+	return
+}
+
+func (w *RoutingWriter) writer(d Destination) (*Writer, error) {
+	w.mu.RLock()
+	writer, ok := w.writers[d]
+	closed := w.closed
+	w.mu.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if ok {
+		return writer, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, ErrClosed
+	}
+	if writer, ok = w.writers[d]; ok {
+		return writer, nil
+	}
+	if len(w.writers) >= w.limit {
+		return nil, fmt.Errorf("%w: %d destinations in use, drop log for %+v", ErrTooManyDestinations, len(w.writers), d)
+	}
+
+	c := w.config
+	c.Project, c.Store, c.Topic = d.Project, d.Store, d.Topic
+	c.MessageFilter, c.MessageModifier = acceptAll{}, nil
+	if c.SpoolDir != "" {
+		c.SpoolDir = spoolDir(c.SpoolDir, d)
+		if err := writeDestination(c.SpoolDir, d); err != nil {
+			return nil, err
+		}
+	}
+
+	writer, err := New(c)
+	if err != nil {
+		return nil, err
+	}
+	w.writers[d] = writer
+	return writer, nil
+}
+
+// acceptAll 用于各目标的 Writer, 日志已在 RoutingWriter 中过滤
+type acceptAll struct{}
+
+func (acceptAll) Filter(Message) bool { return true }
+
+// spoolDir 返回目标 d 的本地缓存目录. 默认目标的 Project 和 Store 未经校验, Topic 可以是任意字符串,
+// 因此以三者的摘要作为目录名, 保证位于 base 之下且各目标互不相同.
+func spoolDir(base string, d Destination) string {
+	sum := sha256.Sum256([]byte(d.Project + "\x00" + d.Store + "\x00" + d.Topic))
+	return filepath.Join(base, hex.EncodeToString(sum[:16]))
+}
+
+// destinationFile 为本地缓存子目录中记录所属目标的文件, 用于启动时找回待重发的日志
+const destinationFile = "destination.json"
+
+func writeDestination(dir string, d Destination) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, destinationFile)
+	if err = os.WriteFile(path+tempExt, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+tempExt, path)
+}
+
+func readDestination(dir string) (d Destination, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, destinationFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &d)
+	return
+}
+
+func hasSegments(dir string) bool {
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), segmentExt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writers 返回已创建的各目标的 Writer, 可用于获取各目标的运行统计
+func (w *RoutingWriter) Writers() []*Writer {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	writers := make([]*Writer, 0, len(w.writers))
+	for _, writer := range w.writers {
+		writers = append(writers, writer)
+	}
+	return writers
+}
+
+// Flush 立即发送所有目标中此前写入的日志, 汇总各目标发送失败的错误
+func (w *RoutingWriter) Flush(ctx context.Context) error {
+	var errs []error
+	for _, writer := range w.Writers() {
+		errs = append(errs, writer.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown 停止接收新日志并关闭所有目标的 Writer, 汇总各目标返回的 *ShutdownError
+func (w *RoutingWriter) Shutdown(ctx context.Context) error {
+	lineErr := w.lines.flush(w.parser, w.WriteMessage)
+
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	writers := w.Writers()
+	errs := make([]error, len(writers))
+
+	var wg sync.WaitGroup
+	for i, writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = writer.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(append(errs, lineErr)...)
+}
+
+// Close 等同于不限时的 Shutdown
+func (w *RoutingWriter) Close() error {
+	return w.Shutdown(context.Background())
+}
@@ -0,0 +1,201 @@
+package sls_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/gota33/aliyun-log-writer/slstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingWriter(t *testing.T) {
+	t.Run("field", func(t *testing.T) {
+		srv := slstest.NewServer()
+		defer srv.Close()
+
+		w, err := sls.NewRoutingWriter(srv.Config("project", "default-store", "topic"), sls.FieldRouter("store"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for _, line := range []string{
+			`{"store":"audit-store","msg":"1"}`,
+			`{"store":"access-store","msg":"2"}`,
+			`{"store":"audit-store","msg":"3"}`,
+			`{"msg":"4"}`,
+		} {
+			_, err = w.Write([]byte(line))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, w.Flush(context.Background()))
+		assert.Len(t, w.Writers(), 3)
+
+		counts := map[string]int{}
+		for _, log := range srv.Logs() {
+			counts[log.Store]++
+			assert.Equal(t, "project", log.Project)
+			assert.Equal(t, "topic", log.Topic)
+		}
+		assert.Equal(t, map[string]int{"audit-store": 2, "access-store": 1, "default-store": 1}, counts)
+
+		assert.NoError(t, w.Close())
+		_, err = w.Write([]byte(`{"msg":"5"}`))
+		assert.ErrorIs(t, err, sls.ErrClosed)
+	})
+
+	t.Run("func", func(t *testing.T) {
+		srv := slstest.NewServer()
+		defer srv.Close()
+
+		router := sls.RouterFunc(func(msg sls.Message) sls.Destination {
+			if msg.Contents["audit"] == "true" {
+				return sls.Destination{Project: "audit-project", Store: "audit-store", Topic: "audit"}
+			}
+			return sls.Destination{}
+		})
+		w, err := sls.NewRoutingWriter(srv.Config("project", "store", "topic"), router)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		logger := slog.New(sls.NewHandler(w, nil))
+		logger.Info("audit", "audit", true)
+		logger.Info("normal")
+		assert.NoError(t, w.Close())
+
+		logs := srv.Logs()
+		if assert.Len(t, logs, 2) {
+			for _, log := range logs {
+				if log.Contents["msg"] == "audit" {
+					assert.Equal(t, sls.Destination{Project: "audit-project", Store: "audit-store", Topic: "audit"},
+						sls.Destination{Project: log.Project, Store: log.Store, Topic: log.Topic})
+				} else {
+					assert.Equal(t, "store", log.Store)
+				}
+			}
+		}
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		srv := slstest.NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "default-store", "topic")
+		c.SpoolDir = t.TempDir()
+		w, err := sls.NewRoutingWriter(c, sls.FieldRouter("store"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() { _ = w.Close() }()
+
+		for _, store := range []string{"..", ".", "../../etc", "a/b", "Audit", "ab", "-store", "store-"} {
+			_, err = w.Write([]byte(`{"store":` + strconv.Quote(store) + `}`))
+			assert.ErrorIs(t, err, sls.ErrInvalidDestination, store)
+		}
+		assert.Empty(t, w.Writers())
+
+		_, err = w.Write([]byte(`{"store":"audit_store-1"}`))
+		assert.NoError(t, err)
+		assert.Len(t, w.Writers(), 1)
+
+		entries, err := os.ReadDir(c.SpoolDir)
+		if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+			assert.True(t, entries[0].IsDir())
+		}
+
+		router := sls.RouterFunc(func(msg sls.Message) sls.Destination {
+			return sls.Destination{Project: msg.Contents["project"]}
+		})
+		w2, err := sls.NewRoutingWriter(c, router)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() { _ = w2.Close() }()
+		_, err = w2.Write([]byte(`{"project":"under_score"}`))
+		assert.ErrorIs(t, err, sls.ErrInvalidDestination)
+	})
+
+	t.Run("restore spool", func(t *testing.T) {
+		srv := slstest.NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "default-store", "topic")
+		c.SpoolDir = t.TempDir()
+		c.Retry = sls.RetryPolicy{MaxAttempts: 1}
+
+		w, err := sls.NewRoutingWriter(c, sls.FieldRouter("store"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		srv.Enqueue(slstest.Response{Err: &sls.AliyunError{HTTPCode: http.StatusServiceUnavailable, Code: "ServerBusy"}})
+		_, err = w.Write([]byte(`{"store":"one-off-store","msg":"1"}`))
+		assert.NoError(t, err)
+		assert.Error(t, w.Flush(context.Background()))
+		assert.NoError(t, w.Close())
+		assert.Empty(t, srv.Logs())
+
+		// 没有元数据的子目录无法恢复, 通过 OnError 报告
+		orphan := filepath.Join(c.SpoolDir, "orphan")
+		assert.NoError(t, os.Mkdir(orphan, 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(orphan, "1-1.seg"), nil, 0o644))
+
+		var errs []error
+		c.OnError = func(err error) { errs = append(errs, err) }
+		w, err = sls.NewRoutingWriter(c, sls.FieldRouter("store"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		if assert.Len(t, errs, 1) {
+			assert.ErrorContains(t, errs[0], "orphan")
+		}
+		if writers := w.Writers(); assert.Len(t, writers, 1) {
+			assert.Equal(t, "one-off-store", writers[0].Destination().Store)
+		}
+
+		assert.Eventually(t, func() bool { return len(srv.Logs()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, "one-off-store", srv.Logs()[0].Store)
+		assert.NoError(t, w.Close())
+	})
+
+	t.Run("max destinations", func(t *testing.T) {
+		srv := slstest.NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "default-store", "topic")
+		c.MaxDestinations = 2
+		w, err := sls.NewRoutingWriter(c, sls.FieldRouter("store"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = w.Write([]byte(`{"store":"store-1"}`))
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(`{"store":"store-2"}`))
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(`{"store":"store-3"}`))
+		assert.ErrorIs(t, err, sls.ErrTooManyDestinations)
+		_, err = w.Write([]byte(`{"store":"store-1"}`))
+		assert.NoError(t, err)
+		assert.Len(t, w.Writers(), 2)
+
+		assert.NoError(t, w.Close())
+		assert.Len(t, srv.Logs(), 3)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		_, err := sls.NewRoutingWriter(sls.Config{}, sls.FieldRouter("store"))
+		assert.Error(t, err)
+
+		srv := slstest.NewServer()
+		defer srv.Close()
+		_, err = sls.NewRoutingWriter(srv.Config("project", "store", "topic"), nil)
+		assert.Error(t, err)
+	})
+}
@@ -8,23 +8,27 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gota33/aliyun-log-writer/api"
-	"github.com/pierrec/lz4"
+	"github.com/gota33/aliyun-log-writer/internal/validator"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
 var (
 	hContentType     = []string{"application/x-protobuf"}
 	hApiVersion      = []string{"0.6.0"}
-	hCompressType    = []string{"lz4"}
 	hSignatureMethod = []string{"hmac-sha1"}
 )
 
@@ -32,75 +36,283 @@ var loc = time.FixedZone("GMT", 0)
 
 func gmtNow() string { return time.Now().In(loc).Format(time.RFC1123) }
 
+const (
+	MaxLogGroupSize   = 5 << 20 // PutLogs 单次请求 LogGroup 编码后的大小上限
+	MaxLogGroupCount  = 4096    // PutLogs 单次请求的日志条数上限
+	DefaultMaxLogSize = 1 << 20
+
+	truncatedMark = "...(truncated)"
+)
+
+var ErrLogTooLarge = errors.New("log is too large")
+
+type OversizePolicy int
+
+const (
+	OversizeTruncate OversizePolicy = iota // 从最长的字段值开始截断, 直到不超过上限
+	OversizeReject                         // 丢弃超出上限的日志并返回 ErrLogTooLarge
+)
+
 type sls struct {
-	Client    *http.Client
-	Timeout   time.Duration
-	AppKey    string
-	AppSecret Secret
-	Uri       *url.URL
-	Host      string
-	Topic     string
-	Source    string
+	Client        *http.Client
+	Timeout       time.Duration
+	Credentials   CredentialsProvider
+	Uri           *url.URL
+	Host          string
+	Topic         string
+	Source        string
+	Retry         RetryPolicy
+	Compression   Compression
+	MaxLogSize    int
+	Oversize      OversizePolicy
+	Tags          map[string]string
+	TimeNano      bool
+	TimeNanoField string
+	packID        *packIDGenerator
+	stats         *stats
+}
+
+// SendError 为 Send 部分日志未送达时返回的错误, 其余日志已发送成功
+type SendError struct {
+	Failed   []Message // 请求失败的日志, 可以重发
+	Rejected int       // 因超出大小上限等原因无法发送的日志条数, 重发也不会成功
+	Err      error     // 所有失败请求及被丢弃日志的错误
 }
 
-func (w *sls) Send(messages ...Message) error {
+func (e *SendError) Error() string {
+	return fmt.Sprintf("%d messages failed, %d rejected: %v", len(e.Failed), e.Rejected, e.Err)
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+// Send 将日志按 PutLogs 的大小和条数限制拆分为多个 LogGroup 依次发送,
+// 存在未送达的日志时返回 *SendError.
+func (w *sls) Send(ctx context.Context, messages ...Message) error {
 	if len(messages) == 0 {
 		return nil
 	}
 
-	raw, err := w.encode(messages...)
-	if err != nil {
-		return err
+	groups, rejected, err := w.encode(messages...)
+	sErr := &SendError{Rejected: rejected}
+	errs := []error{err}
+
+	for _, group := range groups {
+		if err = w.send(ctx, group.raw); err != nil {
+			sErr.Failed = append(sErr.Failed, group.messages...)
+			errs = append(errs, err)
+		}
+	}
+	if sErr.Err = errors.Join(errs...); sErr.Err == nil {
+		return nil
 	}
+	return sErr
+}
 
-	data, err := w.compress(raw)
+func (w *sls) send(ctx context.Context, raw []byte) error {
+	data, err := w.Compression.compress(raw)
 	if err != nil {
 		return err
 	}
 
-	req, err := w.buildRequest(raw, data)
-	if err != nil {
-		return err
+	attempts := 0
+	err = w.Retry.do(ctx, func() error {
+		attempts++
+		if w.stats != nil {
+			w.stats.requests.Add(1)
+			if attempts > 1 {
+				w.stats.retried.Add(1)
+			}
+		}
+
+		req, err := w.buildRequest(ctx, raw, data)
+		if err != nil {
+			return err
+		}
+		return w.fire(req)
+	})
+
+	if err == nil && w.stats != nil {
+		w.stats.rawBytes.Add(int64(len(raw)))
+		w.stats.compressedBytes.Add(int64(len(data)))
 	}
+	return err
+}
 
-	return w.fire(req)
+// logGroup 为编码后的 LogGroup 及其中的日志
+type logGroup struct {
+	raw      []byte
+	messages []Message
 }
 
-func (w *sls) encode(messages ...Message) ([]byte, error) {
-	group := &api.LogGroup{
-		Topic:  &w.Topic,
-		Source: &w.Source,
-		Logs:   make([]*api.Log, len(messages)),
+// encode 按标签将日志分组, 每组按 PutLogs 的大小和条数限制编码为一个或多个 LogGroup,
+// 返回无法编码的日志条数及其错误.
+func (w *sls) encode(messages ...Message) (groups []logGroup, rejected int, err error) {
+	maxLogSize := validator.Coalesce(w.MaxLogSize, DefaultMaxLogSize)
+
+	type tagSet struct {
+		tags     []*api.LogTag
+		logs     []*api.Log
+		messages []Message
 	}
+	var (
+		sets  []*tagSet
+		index = make(map[string]*tagSet)
+		errs  []error
+	)
+
+	for _, original := range messages {
+		message, tags := original.splitTags(w.Tags)
 
-	for i, message := range messages {
-		contents := make([]*api.Log_Content, 0, len(message.Contents))
-		for k, v := range message.Contents {
-			contents = append(contents, &api.Log_Content{
-				Key:   proto.String(k),
-				Value: proto.String(v),
+		log := encodeLog(message, w.TimeNano)
+		if w.TimeNanoField != "" {
+			log.Contents = append(log.Contents, &api.Log_Content{
+				Key:   proto.String(w.TimeNanoField),
+				Value: proto.String(strconv.FormatInt(message.Time.UnixNano(), 10)),
 			})
 		}
-		group.Logs[i] = &api.Log{
-			Time:     proto.Uint32(uint32(message.Time.Unix())),
-			Contents: contents,
+		if logSize := proto.Size(log); logSize > maxLogSize {
+			if w.Oversize == OversizeReject || !truncateLog(log, maxLogSize) {
+				errs = append(errs, fmt.Errorf("%w: %d bytes exceeds %d", ErrLogTooLarge, logSize, maxLogSize))
+				rejected++
+				continue
+			}
+		}
+
+		logTags := encodeTags(tags)
+		key := tagsKey(logTags)
+		set, ok := index[key]
+		if !ok {
+			set = &tagSet{tags: logTags}
+			index[key] = set
+			sets = append(sets, set)
 		}
+		set.logs = append(set.logs, log)
+		set.messages = append(set.messages, original)
 	}
-	return proto.Marshal(group)
+
+	for _, set := range sets {
+		newGroup := func() *api.LogGroup {
+			return &api.LogGroup{Topic: &w.Topic, Source: &w.Source, LogTags: set.tags}
+		}
+		group, members := newGroup(), []Message(nil)
+		baseSize := proto.Size(group)
+		if w.packID != nil {
+			baseSize += w.packID.maxTagSize()
+		}
+		size := baseSize
+
+		flush := func() {
+			if len(group.Logs) == 0 {
+				return
+			}
+			if w.packID != nil {
+				// 只为实际发送的 LogGroup 分配序号, 保证同一前缀下的序号连续
+				group.LogTags = append(set.tags[:len(set.tags):len(set.tags)], w.packID.tag())
+			}
+			if data, err := proto.Marshal(group); err != nil {
+				errs = append(errs, err)
+				rejected += len(members)
+			} else {
+				groups = append(groups, logGroup{raw: data, messages: members})
+			}
+			group, members = newGroup(), nil
+			size = baseSize
+		}
+
+		for i, log := range set.logs {
+			// Logs 为 LogGroup 的第 1 个 repeated 字段, 每条日志额外占用 1 字节 tag 和长度前缀
+			logSize := proto.Size(log)
+			itemSize := 1 + protowire.SizeVarint(uint64(logSize)) + logSize
+			if len(group.Logs) >= MaxLogGroupCount || size+itemSize > MaxLogGroupSize {
+				flush()
+			}
+			group.Logs = append(group.Logs, log)
+			members = append(members, set.messages[i])
+			size += itemSize
+		}
+		flush()
+	}
+
+	return groups, rejected, errors.Join(errs...)
+}
+
+// encodeTags 按标签名排序, 使相同的标签组合编码结果一致
+func encodeTags(tags map[string]string) []*api.LogTag {
+	if len(tags) == 0 {
+		return nil
+	}
+	logTags := make([]*api.LogTag, 0, len(tags))
+	for k, v := range tags {
+		logTags = append(logTags, &api.LogTag{Key: proto.String(k), Value: proto.String(v)})
+	}
+	sort.Slice(logTags, func(i, j int) bool { return logTags[i].GetKey() < logTags[j].GetKey() })
+	return logTags
+}
+
+func tagsKey(tags []*api.LogTag) string {
+	var b strings.Builder
+	for _, tag := range tags {
+		b.WriteString(strconv.Quote(tag.GetKey()))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(tag.GetValue()))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// truncateLog 从最长的字段值开始截断, 直到日志编码后不超过 maxSize, 无法截断到上限以内时返回 false
+func truncateLog(log *api.Log, maxSize int) bool {
+	contents := slices.Clone(log.Contents)
+	sort.SliceStable(contents, func(i, j int) bool {
+		return len(contents[i].GetValue()) > len(contents[j].GetValue())
+	})
+
+	for _, content := range contents {
+		excess := proto.Size(log) - maxSize
+		if excess <= 0 {
+			return true
+		}
+
+		value := content.GetValue()
+		if len(value) <= len(truncatedMark) {
+			continue
+		}
+
+		keep := max(len(value)-excess-len(truncatedMark), 0)
+		for keep > 0 && !utf8.RuneStart(value[keep]) {
+			keep--
+		}
+		content.Value = proto.String(value[:keep] + truncatedMark)
+	}
+	return proto.Size(log) <= maxSize
 }
 
-func (w *sls) compress(data []byte) ([]byte, error) {
-	out := make([]byte, lz4.CompressBlockBound(len(data)))
-	var hashTable [1 << 16]int
-	n, err := lz4.CompressBlock(data, out, hashTable[:])
+// encodeLog 将日志编码为 api.Log, nano 为 true 时在 Time_ns 中写入时间的纳秒部分
+func encodeLog(message Message, nano bool) *api.Log {
+	contents := make([]*api.Log_Content, 0, len(message.Contents))
+	for k, v := range message.Contents {
+		contents = append(contents, &api.Log_Content{
+			Key:   proto.String(k),
+			Value: proto.String(v),
+		})
+	}
+	log := &api.Log{
+		Time:     proto.Uint32(uint32(message.Time.Unix())),
+		Contents: contents,
+	}
+	if nano {
+		log.TimeNs = proto.Uint32(uint32(message.Time.Nanosecond()))
+	}
+	return log
+}
+
+func (w *sls) buildRequest(ctx context.Context, raw, data []byte) (*http.Request, error) {
+	cred, err := w.Credentials.Credentials(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return out[:n], nil
-}
 
-func (w *sls) buildRequest(raw, data []byte) (*http.Request, error) {
-	req, err := http.NewRequest("POST", w.Uri.String(), bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", w.Uri.String(), bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -113,23 +325,30 @@ func (w *sls) buildRequest(raw, data []byte) (*http.Request, error) {
 		"Host":                  []string{w.Host},
 		"X-Log-Apiversion":      hApiVersion,
 		"X-Log-Bodyrawsize":     []string{strconv.Itoa(len(raw))},
-		"X-Log-Compresstype":    hCompressType,
 		"X-Log-Signaturemethod": hSignatureMethod,
 	}
 
-	sign, err := signature(w.AppSecret, req)
+	if compressType := w.Compression.header(); compressType != "" {
+		req.Header["X-Log-Compresstype"] = []string{compressType}
+	}
+
+	if cred.SecurityToken != "" {
+		req.Header["X-Acs-Security-Token"] = []string{cred.SecurityToken}
+	}
+
+	sign, err := signature(cred.AccessKeySecret, req)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header["Authorization"] = []string{fmt.Sprintf("LOG %s:%s", w.AppKey, sign)}
+	req.Header["Authorization"] = []string{fmt.Sprintf("LOG %s:%s", cred.AccessKeyID, sign)}
 
 	return req, nil
 }
 
 func (w *sls) fire(req *http.Request) error {
 	if w.Timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+		ctx, cancel := context.WithTimeout(req.Context(), w.Timeout)
 		defer cancel()
 
 		req = req.WithContext(ctx)
@@ -152,9 +371,14 @@ func (w *sls) validateResponse(resp *http.Response) error {
 		HTTPCode:  int32(resp.StatusCode),
 		RequestID: resp.Header.Get("X-Log-Requestid"),
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&aErr); err != nil {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
 		return err
 	}
+	if err = json.Unmarshal(body, &aErr); err != nil {
+		// 网关等返回的非 JSON 响应, 保留状态码以便判断是否可以重试
+		aErr.Message = strings.TrimSpace(string(body))
+	}
 	return &aErr
 }
 
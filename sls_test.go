@@ -1,17 +1,23 @@
 package sls
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/gota33/aliyun-log-writer/api"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
 )
 
 // {"errorCode":"ParameterInvalid","errorMessage":"http extend authorization : LOG :WL2xp3EYvKpsIGgwE3s5HHK7M/c= pair is invalid"}
@@ -78,14 +84,13 @@ func TestClient(t *testing.T) {
 		u, err := url.Parse(uri)
 		assert.NoError(t, err)
 		return &sls{
-			Client:    http.DefaultClient,
-			AppKey:    DefaultAccessKey,
-			AppSecret: DefaultAccessSecret,
-			Uri:       u,
-			Host:      u.Host,
-			Topic:     DefaultTopic,
-			Source:    DefaultSource,
-			Timeout:   DefaultTimeout,
+			Client:      http.DefaultClient,
+			Credentials: StaticCredentials(DefaultAccessKey, string(DefaultAccessSecret), ""),
+			Uri:         u,
+			Host:        u.Host,
+			Topic:       DefaultTopic,
+			Source:      DefaultSource,
+			Timeout:     DefaultTimeout,
 		}
 	}
 
@@ -95,7 +100,7 @@ func TestClient(t *testing.T) {
 
 		writer := newWriter(t, srv.URL)
 
-		err := writer.Send(ShortMessage)
+		err := writer.Send(context.Background(), ShortMessage)
 		assert.NoError(t, err)
 	})
 
@@ -104,7 +109,7 @@ func TestClient(t *testing.T) {
 		defer srv.Close()
 
 		writer := newWriter(t, srv.URL)
-		err := writer.Send(Messages...)
+		err := writer.Send(context.Background(), Messages...)
 		assert.NoError(t, err)
 	})
 
@@ -113,7 +118,7 @@ func TestClient(t *testing.T) {
 		defer srv.Close()
 
 		writer := newWriter(t, srv.URL)
-		err := writer.Send(ShortMessage)
+		err := writer.Send(context.Background(), ShortMessage)
 
 		var aErr *AliyunError
 		if assert.True(t, errors.As(err, &aErr)) {
@@ -121,6 +126,295 @@ func TestClient(t *testing.T) {
 			assert.JSONEq(t, DefaultErrorMessage, aErr.Error())
 		}
 	})
+
+	t.Run("security token", func(t *testing.T) {
+		const token = "sts-token"
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			assert.Equal(t, token, req.Header.Get("X-Acs-Security-Token"))
+
+			sign, err := signature(Secret("sts-secret"), req)
+			assert.NoError(t, err)
+			assert.Equal(t, "LOG sts-key:"+sign, req.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		writer := newWriter(t, srv.URL+"/logstores/test-store/shards/lb")
+		writer.Credentials = StaticCredentials("sts-key", "sts-secret", token)
+		assert.NoError(t, writer.Send(context.Background(), ShortMessage))
+	})
+
+	t.Run("credentials error", func(t *testing.T) {
+		writer := newWriter(t, "http://127.0.0.1")
+		writer.Credentials = EnvCredentials()
+		t.Setenv(EnvAccessKeyID, "")
+		assert.ErrorIs(t, writer.Send(context.Background(), ShortMessage), ErrNoCredentials)
+	})
+
+	t.Run("compression", func(t *testing.T) {
+		for _, c := range []Compression{CompressLz4, CompressZstd, CompressDeflate, CompressNone} {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				compressType := Compression(req.Header.Get("X-Log-Compresstype"))
+				if compressType == "" {
+					compressType = CompressNone
+				}
+				assert.Equal(t, c, compressType)
+
+				data, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				rawSize, err := strconv.Atoi(req.Header.Get("X-Log-Bodyrawsize"))
+				assert.NoError(t, err)
+
+				raw, err := compressType.decompress(data, rawSize)
+				if assert.NoError(t, err) {
+					assert.Len(t, raw, rawSize)
+
+					var group api.LogGroup
+					assert.NoError(t, proto.Unmarshal(raw, &group))
+					assert.Len(t, group.Logs, len(Messages))
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			writer := newWriter(t, srv.URL)
+			writer.Compression = c
+			assert.NoError(t, writer.Send(context.Background(), Messages...), c)
+			srv.Close()
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		requests := &atomic.Int32{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		writer := newWriter(t, srv.URL)
+		err := writer.Send(context.Background(), makeMessages(2*MaxLogGroupCount+1)...)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, requests.Load())
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		requests := &atomic.Int32{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if requests.Add(1) == 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"errorCode":"ServerBusy","errorMessage":"server busy"}`))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		messages := makeMessages(2*MaxLogGroupCount + 1)
+		writer := newWriter(t, srv.URL)
+		err := writer.Send(context.Background(), messages...)
+		assert.EqualValues(t, 3, requests.Load())
+
+		var sendErr *SendError
+		if assert.ErrorAs(t, err, &sendErr) {
+			assert.Equal(t, messages[MaxLogGroupCount:2*MaxLogGroupCount], sendErr.Failed)
+			assert.Zero(t, sendErr.Rejected)
+			assert.True(t, IsRetryable(err))
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		count := &atomic.Int32{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if count.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"errorCode":"ServerBusy","errorMessage":"server busy"}`))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		writer := newWriter(t, srv.URL)
+		writer.Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		writer.stats = &stats{}
+		err := writer.Send(context.Background(), ShortMessage)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, count.Load())
+
+		st := writer.stats.snapshot()
+		assert.EqualValues(t, 3, st.Requests)
+		assert.EqualValues(t, 2, st.Retried)
+		assert.Positive(t, st.RawBytes)
+		assert.Positive(t, st.CompressedBytes)
+	})
+
+	t.Run("non-json error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("<html>bad gateway</html>\n"))
+		}))
+		defer srv.Close()
+
+		writer := newWriter(t, srv.URL)
+		err := writer.Send(context.Background(), ShortMessage)
+
+		var aErr *AliyunError
+		if assert.True(t, errors.As(err, &aErr)) {
+			assert.EqualValues(t, http.StatusBadGateway, aErr.HTTPCode)
+			assert.Equal(t, "<html>bad gateway</html>", aErr.Message)
+			assert.True(t, IsRetryable(err))
+		}
+	})
+}
+
+func decodeGroup(t *testing.T, data []byte) *api.LogGroup {
+	var group api.LogGroup
+	assert.NoError(t, proto.Unmarshal(data, &group))
+	return &group
+}
+
+func TestEncode(t *testing.T) {
+	newMessage := func(size int) Message {
+		return Message{
+			Time:     time.Now(),
+			Contents: map[string]string{"small": "value", "large": strings.Repeat("x", size)},
+		}
+	}
+
+	t.Run("split by count", func(t *testing.T) {
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource}
+		groups, _, err := w.encode(makeMessages(MaxLogGroupCount + 1)...)
+		if assert.NoError(t, err) && assert.Len(t, groups, 2) {
+			assert.Len(t, decodeGroup(t, groups[0].raw).Logs, MaxLogGroupCount)
+			assert.Len(t, decodeGroup(t, groups[1].raw).Logs, 1)
+			assert.Equal(t, DefaultTopic, decodeGroup(t, groups[1].raw).GetTopic())
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource, Tags: map[string]string{"cluster": "prod", "pod": "default"}}
+		groups, _, err := w.encode(
+			Message{Contents: map[string]string{"no": "0"}},
+			Message{Contents: map[string]string{"no": "1"}, Tags: map[string]string{"pod": "a"}},
+			Message{Contents: map[string]string{"no": "2", TagPrefix + "pod": "a"}},
+			Message{Contents: map[string]string{"no": "3"}},
+		)
+		if !assert.NoError(t, err) || !assert.Len(t, groups, 2) {
+			return
+		}
+
+		tags := func(group *api.LogGroup) map[string]string {
+			m := make(map[string]string)
+			for _, tag := range group.LogTags {
+				m[tag.GetKey()] = tag.GetValue()
+			}
+			return m
+		}
+
+		first, second := decodeGroup(t, groups[0].raw), decodeGroup(t, groups[1].raw)
+		assert.Equal(t, map[string]string{"cluster": "prod", "pod": "default"}, tags(first))
+		assert.Len(t, first.Logs, 2)
+		assert.Equal(t, map[string]string{"cluster": "prod", "pod": "a"}, tags(second))
+		if assert.Len(t, second.Logs, 2) {
+			for _, log := range second.Logs {
+				assert.Len(t, log.Contents, 1)
+				assert.Equal(t, "no", log.Contents[0].GetKey())
+			}
+		}
+	})
+
+	t.Run("time ns", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+		msg := Message{Time: now, Contents: map[string]string{"msg": "hello"}}
+
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource}
+		groups, _, err := w.encode(msg)
+		if assert.NoError(t, err) && assert.Len(t, groups, 1) {
+			log := decodeGroup(t, groups[0].raw).Logs[0]
+			assert.Nil(t, log.TimeNs)
+			assert.Len(t, log.Contents, 1)
+		}
+
+		w.TimeNano, w.TimeNanoField = true, "__time_ns__"
+		groups, _, err = w.encode(msg)
+		if assert.NoError(t, err) && assert.Len(t, groups, 1) {
+			log := decodeGroup(t, groups[0].raw).Logs[0]
+			assert.EqualValues(t, now.Unix(), log.GetTime())
+			assert.EqualValues(t, 123456789, log.GetTimeNs())
+			if assert.Len(t, log.Contents, 2) {
+				assert.Equal(t, "__time_ns__", log.Contents[1].GetKey())
+				assert.Equal(t, "1577836800123456789", log.Contents[1].GetValue())
+			}
+		}
+		assert.Len(t, msg.Contents, 1)
+	})
+
+	t.Run("split by size", func(t *testing.T) {
+		w := &sls{Topic: DefaultTopic, Source: DefaultSource}
+		messages := make([]Message, 6)
+		for i := range messages {
+			messages[i] = newMessage(DefaultMaxLogSize - 100)
+		}
+
+		groups, _, err := w.encode(messages...)
+		if assert.NoError(t, err) && assert.Len(t, groups, 2) {
+			for _, group := range groups {
+				assert.LessOrEqual(t, len(group.raw), MaxLogGroupSize)
+			}
+			assert.Len(t, decodeGroup(t, groups[0].raw).Logs, 5)
+			assert.Len(t, decodeGroup(t, groups[1].raw).Logs, 1)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		w := &sls{MaxLogSize: 1000}
+		groups, _, err := w.encode(newMessage(100), newMessage(2000))
+		if assert.NoError(t, err) && assert.Len(t, groups, 1) {
+			logs := decodeGroup(t, groups[0].raw).Logs
+			if assert.Len(t, logs, 2) {
+				assert.LessOrEqual(t, proto.Size(logs[1]), 1000)
+				for _, content := range logs[1].Contents {
+					switch content.GetKey() {
+					case "large":
+						assert.True(t, strings.HasSuffix(content.GetValue(), truncatedMark))
+					case "small":
+						assert.Equal(t, "value", content.GetValue())
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		w := &sls{MaxLogSize: 1000, Oversize: OversizeReject}
+		small, large := newMessage(100), newMessage(2000)
+		groups, rejected, err := w.encode(small, large)
+		assert.ErrorIs(t, err, ErrLogTooLarge)
+		assert.Equal(t, 1, rejected)
+		if assert.Len(t, groups, 1) {
+			assert.Len(t, decodeGroup(t, groups[0].raw).Logs, 1)
+			assert.Equal(t, []Message{small}, groups[0].messages)
+		}
+	})
+}
+
+func TestTruncateLog(t *testing.T) {
+	log := encodeLog(Message{Contents: map[string]string{
+		"a": strings.Repeat("中", 100),
+		"b": strings.Repeat("b", 50),
+	}}, false)
+
+	assert.True(t, truncateLog(log, 200))
+	assert.LessOrEqual(t, proto.Size(log), 200)
+	for _, content := range log.Contents {
+		assert.True(t, utf8.ValidString(content.GetValue()))
+		if content.GetKey() == "b" {
+			assert.Equal(t, strings.Repeat("b", 50), content.GetValue())
+		}
+	}
+
+	log = encodeLog(Message{Contents: map[string]string{strings.Repeat("k", 100): "v"}}, false)
+	assert.False(t, truncateLog(log, 50))
 }
 
 func TestSignature(t *testing.T) {
@@ -181,18 +475,17 @@ func BenchmarkWriter(b *testing.B) {
 
 		uri, _ := url.Parse(srv.URL)
 		writer := &sls{
-			Client:    http.DefaultClient,
-			AppKey:    "any",
-			AppSecret: Secret("any"),
-			Uri:       uri,
-			Host:      uri.Host,
-			Topic:     "any",
-			Source:    "any",
+			Client:      http.DefaultClient,
+			Credentials: StaticCredentials("any", "any", ""),
+			Uri:         uri,
+			Host:        uri.Host,
+			Topic:       "any",
+			Source:      "any",
 		}
 
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			if err := writer.Send(msg); err != nil {
+			if err := writer.Send(context.Background(), msg); err != nil {
 				b.Fatal(err)
 			}
 		}
@@ -0,0 +1,344 @@
+// Package slstest 提供进程内的 SLS PutLogs 模拟服务, 用于在测试中验证写入的日志.
+package slstest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/gota33/aliyun-log-writer/api"
+	"github.com/gota33/aliyun-log-writer/filters"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultAccessKeyID     = "test-key"
+	DefaultAccessKeySecret = "test-secret"
+	DefaultEndpoint        = "log.slstest.local"
+)
+
+// Log 为模拟服务收到的一条日志
+type Log struct {
+	Project  string
+	Store    string
+	Topic    string
+	Source   string
+	Tags     map[string]string
+	Time     time.Time // 未设置 Time_ns 时精确到秒
+	Contents map[string]string
+}
+
+// Response 为预先设定的一次响应, Err 为空时返回成功
+type Response struct {
+	Delay time.Duration    // 响应前的等待时间
+	Err   *sls.AliyunError // 返回的错误, HTTPCode 为空时使用 500
+}
+
+// Server 为模拟的 PutLogs 服务, 校验请求签名和 Content-MD5, 按 X-Log-Compresstype 解压请求体,
+// 解码 LogGroup 并保存其中的日志. 校验失败的请求返回与 SLS 相同格式的错误.
+type Server struct {
+	AccessKeyID     string // 校验签名使用的 AccessKeyID
+	AccessKeySecret string // 校验签名使用的 AccessKeySecret
+	SecurityToken   string // 不为空时校验 X-Acs-Security-Token 请求头
+
+	srv       *httptest.Server
+	mu        sync.Mutex
+	logs      []Log
+	requests  int
+	latency   time.Duration
+	responses []Response
+	rejected  []error
+}
+
+// NewServer 启动使用 DefaultAccessKeyID 和 DefaultAccessKeySecret 校验签名的模拟服务
+func NewServer() *Server {
+	s := &Server{
+		AccessKeyID:     DefaultAccessKeyID,
+		AccessKeySecret: DefaultAccessKeySecret,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) Close() { s.srv.Close() }
+
+// URL 返回模拟服务的实际地址
+func (s *Server) URL() string { return s.srv.URL }
+
+// Client 返回将所有请求发送到模拟服务的 HTTP 客户端,
+// 使 "<project>.<endpoint>" 形式的域名无需解析即可访问模拟服务.
+func (s *Server) Client() *http.Client {
+	addr := s.srv.Listener.Addr().String()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Config 返回写入模拟服务的 sls.Config, MessageFilter 为不过滤任何日志的空 filters.Chain, 其余字段可按需修改
+func (s *Server) Config(project, store, topic string) sls.Config {
+	return sls.Config{
+		Endpoint:      DefaultEndpoint,
+		AccessKey:     s.AccessKeyID,
+		AccessSecret:  s.AccessKeySecret,
+		Project:       project,
+		Store:         store,
+		Topic:         topic,
+		HttpClient:    s.Client(),
+		MessageFilter: filters.Chain{},
+	}
+}
+
+// Logs 返回收到的全部日志
+func (s *Server) Logs() []Log {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Log(nil), s.logs...)
+}
+
+// Requests 返回收到的 PutLogs 请求次数, 包括返回错误的请求
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Rejected 返回因签名, Content-MD5 或请求体无效而被拒绝的请求的错误
+func (s *Server) Rejected() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.rejected...)
+}
+
+// SetLatency 设置每次请求的默认响应延迟
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Enqueue 追加预先设定的响应, 之后的请求按顺序使用, 用完后恢复默认的成功响应
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Reset 清空收到的日志, 请求计数及未使用的预设响应
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs, s.requests, s.responses, s.rejected = nil, 0, nil, nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	resp := Response{Delay: s.latency}
+	if len(s.responses) > 0 {
+		resp = s.responses[0]
+		s.responses = s.responses[1:]
+	}
+	s.mu.Unlock()
+
+	if resp.Delay > 0 {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(resp.Delay):
+		}
+	}
+
+	if resp.Err != nil {
+		writeError(w, *resp.Err)
+		return
+	}
+
+	logs, aErr := s.putLogs(req)
+	if aErr != nil {
+		s.mu.Lock()
+		s.rejected = append(s.rejected, aErr)
+		s.mu.Unlock()
+		writeError(w, *aErr)
+		return
+	}
+
+	s.mu.Lock()
+	s.logs = append(s.logs, logs...)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) putLogs(req *http.Request) ([]Log, *sls.AliyunError) {
+	if req.Method != http.MethodPost {
+		return nil, newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "method %s is not allowed", req.Method)
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "logstores" || parts[2] != "shards" || parts[3] != "lb" {
+		return nil, newError(http.StatusNotFound, "InvalidPath", "path %q is not PutLogs", req.URL.Path)
+	}
+	store := parts[1]
+	project, _, _ := strings.Cut(req.Host, ".")
+
+	if aErr := s.verifySignature(req); aErr != nil {
+		return nil, aErr
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "InvalidBody", "read body: %v", err)
+	}
+	if sum := fmt.Sprintf("%X", md5.Sum(body)); sum != strings.ToUpper(req.Header.Get("Content-MD5")) {
+		return nil, newError(http.StatusBadRequest, "InvalidContentMD5", "Content-MD5 %q mismatch, expect %q", req.Header.Get("Content-MD5"), sum)
+	}
+
+	rawSize, err := strconv.Atoi(req.Header.Get("X-Log-Bodyrawsize"))
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "InvalidBodyRawSize", "invalid x-log-bodyrawsize: %v", err)
+	}
+	raw, err := decompress(req.Header.Get("X-Log-Compresstype"), body, rawSize)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "InvalidCompressType", "decompress: %v", err)
+	}
+	if len(raw) != rawSize {
+		return nil, newError(http.StatusBadRequest, "InvalidBodyRawSize", "raw size %d mismatch, expect %d", len(raw), rawSize)
+	}
+
+	var group api.LogGroup
+	if err = proto.Unmarshal(raw, &group); err != nil {
+		return nil, newError(http.StatusBadRequest, "InvalidLogGroup", "decode LogGroup: %v", err)
+	}
+
+	tags := make(map[string]string, len(group.LogTags))
+	for _, tag := range group.LogTags {
+		tags[tag.GetKey()] = tag.GetValue()
+	}
+
+	logs := make([]Log, len(group.Logs))
+	for i, log := range group.Logs {
+		contents := make(map[string]string, len(log.Contents))
+		for _, content := range log.Contents {
+			contents[content.GetKey()] = content.GetValue()
+		}
+		logs[i] = Log{
+			Project:  project,
+			Store:    store,
+			Topic:    group.GetTopic(),
+			Source:   group.GetSource(),
+			Tags:     tags,
+			Time:     time.Unix(int64(log.GetTime()), int64(log.GetTimeNs())),
+			Contents: contents,
+		}
+	}
+	return logs, nil
+}
+
+func (s *Server) verifySignature(req *http.Request) *sls.AliyunError {
+	if s.SecurityToken != "" && req.Header.Get("X-Acs-Security-Token") != s.SecurityToken {
+		return newError(http.StatusUnauthorized, "Unauthorized", "invalid security token")
+	}
+
+	keyID, sign, ok := strings.Cut(strings.TrimPrefix(req.Header.Get("Authorization"), "LOG "), ":")
+	if !ok || keyID != s.AccessKeyID {
+		return newError(http.StatusUnauthorized, "Unauthorized", "unknown access key %q", keyID)
+	}
+
+	// SignString = VERB + "\n" + CONTENT-MD5 + "\n" + CONTENT-TYPE + "\n" + DATE + "\n"
+	//              + CanonicalizedSLSHeaders + "\n" + CanonicalizedResource
+	lines := []string{
+		req.Method,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+	}
+	var headers []string
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-log-") || strings.HasPrefix(k, "x-acs-") {
+			headers = append(headers, k+":"+strings.TrimSpace(strings.Join(v, ",")))
+		}
+	}
+	sort.Strings(headers)
+	lines = append(lines, headers...)
+	lines = append(lines, req.URL.EscapedPath())
+
+	mac := hmac.New(sha1.New, []byte(s.AccessKeySecret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(sign), []byte(expected)) {
+		return newError(http.StatusUnauthorized, "SignatureNotMatch", "signature %q mismatch", sign)
+	}
+	return nil
+}
+
+func decompress(compressType string, data []byte, rawSize int) ([]byte, error) {
+	switch compressType {
+	case "":
+		return data, nil
+	case "lz4":
+		out := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(data, out)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case "zstd":
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = zr.Close() }()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported compress type %q", compressType)
+	}
+}
+
+func newError(status int, code, format string, args ...any) *sls.AliyunError {
+	return &sls.AliyunError{
+		HTTPCode: int32(status),
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func writeError(w http.ResponseWriter, aErr sls.AliyunError) {
+	status := int(aErr.HTTPCode)
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(aErr)
+}
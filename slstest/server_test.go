@@ -0,0 +1,165 @@
+package slstest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	sls "github.com/gota33/aliyun-log-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	newWriter := func(t *testing.T, c sls.Config) *sls.Writer {
+		w, err := sls.New(c)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return w
+	}
+
+	t.Run("put logs", func(t *testing.T) {
+		for _, compression := range []sls.Compression{sls.CompressLz4, sls.CompressZstd, sls.CompressDeflate, sls.CompressNone} {
+			t.Run(string(compression), func(t *testing.T) {
+				srv := NewServer()
+				defer srv.Close()
+
+				c := srv.Config("project", "store", "topic")
+				c.Source = "source"
+				c.Compression = compression
+				w := newWriter(t, c)
+
+				_, err := w.Write([]byte(`{"time":"2020-01-01T00:00:00Z","msg":"hello"}`))
+				assert.NoError(t, err)
+				assert.NoError(t, w.Close())
+
+				assert.Empty(t, srv.Rejected())
+				logs := srv.Logs()
+				if assert.Len(t, logs, 1) {
+					assert.Equal(t, "project", logs[0].Project)
+					assert.Equal(t, "store", logs[0].Store)
+					assert.Equal(t, "topic", logs[0].Topic)
+					assert.Equal(t, "source", logs[0].Source)
+					assert.Equal(t, "hello", logs[0].Contents["msg"])
+					assert.True(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Equal(logs[0].Time))
+				}
+			})
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "store", "topic")
+		c.Tags = map[string]string{"cluster": "prod"}
+		w := newWriter(t, c)
+
+		assert.NoError(t, w.WriteMessage(sls.Message{
+			Time:     time.Now(),
+			Contents: map[string]string{"msg": "hello"},
+			Tags:     map[string]string{"pod": "a"},
+		}))
+		assert.NoError(t, w.Close())
+
+		logs := srv.Logs()
+		if assert.Len(t, logs, 1) {
+			assert.Regexp(t, `^[0-9A-F]{16}-0$`, logs[0].Tags[sls.PackIDTag])
+			delete(logs[0].Tags, sls.PackIDTag)
+			assert.Equal(t, map[string]string{"cluster": "prod", "pod": "a"}, logs[0].Tags)
+			assert.Equal(t, map[string]string{"msg": "hello"}, logs[0].Contents)
+		}
+	})
+
+	t.Run("time ns", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "store", "topic")
+		c.TimeNano = true
+		w := newWriter(t, c)
+
+		now := time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+		assert.NoError(t, w.WriteMessage(sls.Message{Time: now, Contents: map[string]string{"msg": "hello"}}))
+		assert.NoError(t, w.Close())
+
+		logs := srv.Logs()
+		if assert.Len(t, logs, 1) {
+			assert.True(t, now.Equal(logs[0].Time))
+		}
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+
+		c := srv.Config("project", "store", "topic")
+		c.AccessSecret = "wrong"
+		w := newWriter(t, c)
+
+		_, _ = w.Write([]byte(`{"msg":"hello"}`))
+		err := w.Flush(context.Background())
+
+		var aErr *sls.AliyunError
+		if assert.ErrorAs(t, err, &aErr) {
+			assert.Equal(t, "SignatureNotMatch", aErr.Code)
+		}
+		assert.Len(t, srv.Rejected(), 1)
+		assert.Empty(t, srv.Logs())
+		_ = w.Close()
+	})
+
+	t.Run("security token", func(t *testing.T) {
+		srv := NewServer()
+		srv.SecurityToken = "token"
+		defer srv.Close()
+
+		c := srv.Config("project", "store", "topic")
+		c.Credentials = sls.StaticCredentials(srv.AccessKeyID, srv.AccessKeySecret, "token")
+		w := newWriter(t, c)
+
+		_, _ = w.Write([]byte(`{"msg":"hello"}`))
+		assert.NoError(t, w.Flush(context.Background()))
+		assert.Len(t, srv.Logs(), 1)
+		_ = w.Close()
+	})
+
+	t.Run("scripted errors", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+		srv.Enqueue(
+			Response{Err: &sls.AliyunError{HTTPCode: http.StatusServiceUnavailable, Code: "ServerBusy"}},
+			Response{Delay: 10 * time.Millisecond, Err: &sls.AliyunError{Code: "InternalServerError"}},
+		)
+
+		c := srv.Config("project", "store", "topic")
+		c.Retry = sls.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		w := newWriter(t, c)
+
+		_, _ = w.Write([]byte(`{"msg":"hello"}`))
+		assert.NoError(t, w.Flush(context.Background()))
+		assert.Equal(t, 3, srv.Requests())
+		assert.Len(t, srv.Logs(), 1)
+		_ = w.Close()
+
+		srv.Reset()
+		assert.Zero(t, srv.Requests())
+		assert.Empty(t, srv.Logs())
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		srv := NewServer()
+		defer srv.Close()
+		srv.SetLatency(50 * time.Millisecond)
+
+		c := srv.Config("project", "store", "topic")
+		c.Timeout = 10 * time.Millisecond
+		c.Retry = sls.RetryPolicy{MaxAttempts: 1}
+		w := newWriter(t, c)
+
+		_, _ = w.Write([]byte(`{"msg":"hello"}`))
+		assert.ErrorIs(t, w.Flush(context.Background()), context.DeadlineExceeded)
+		_ = w.Close()
+	})
+}
@@ -0,0 +1,221 @@
+package sls
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gota33/aliyun-log-writer/api"
+	"google.golang.org/protobuf/proto"
+)
+
+const DefaultSpoolMaxSize int64 = 100 << 20
+
+var (
+	ErrSpoolFull = errors.New("spool is full")
+
+	// errCorruptSegment 表示分段文件内容无法解码, 重新读取也不会成功
+	errCorruptSegment = errors.New("corrupt spool segment")
+)
+
+type SpoolPolicy int
+
+const (
+	SpoolDropOldest SpoolPolicy = iota // 超出容量时删除最旧的日志
+	SpoolDropNewest                    // 超出容量时丢弃新写入的日志
+)
+
+const (
+	segmentExt = ".seg"
+	tempExt    = ".tmp"
+)
+
+type segment struct {
+	name  string
+	seq   uint64
+	count int
+	size  int64
+}
+
+// spool 将发送失败的日志按批次写入本地目录, 每批一个分段文件,
+// 文件名中包含递增序号和日志条数, 内容为编码后的 LogGroup.
+type spool struct {
+	dir      string
+	maxSize  int64
+	policy   SpoolPolicy
+	mu       sync.Mutex
+	segments []segment
+	size     int64
+	seq      uint64
+}
+
+func openSpool(dir string, maxSize int64, policy SpoolPolicy) (s *spool, err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	s = &spool{dir: dir, maxSize: maxSize, policy: policy}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, tempExt) {
+			// 写入过程中进程退出留下的临时文件
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		var seg segment
+		if _, err := fmt.Sscanf(name, "%d-%d"+segmentExt, &seg.seq, &seg.count); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seg.name = name
+		seg.size = info.Size()
+
+		s.segments = append(s.segments, seg)
+		s.size += seg.size
+		s.seq = max(s.seq, seg.seq)
+	}
+	logger.Printf("Spool: %d segments, %d bytes", len(s.segments), s.size)
+	return
+}
+
+// Append 将一批日志写入新的分段, 返回因超出容量而被删除的日志条数.
+func (s *spool) Append(messages []Message) (evicted int, err error) {
+	if len(messages) == 0 {
+		return
+	}
+
+	data, err := encodeSegment(messages)
+	if err != nil {
+		return
+	}
+	size := int64(len(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if size > s.maxSize {
+		return 0, ErrSpoolFull
+	}
+	for s.size+size > s.maxSize {
+		if s.policy == SpoolDropNewest {
+			return evicted, ErrSpoolFull
+		}
+		oldest := s.segments[0]
+		if err = s.removeLocked(oldest); err != nil {
+			return
+		}
+		evicted += oldest.count
+	}
+
+	s.seq++
+	seg := segment{
+		name:  fmt.Sprintf("%020d-%d%s", s.seq, len(messages), segmentExt),
+		seq:   s.seq,
+		count: len(messages),
+		size:  size,
+	}
+
+	path := filepath.Join(s.dir, seg.name)
+	if err = os.WriteFile(path+tempExt, data, 0o644); err != nil {
+		return
+	}
+	if err = os.Rename(path+tempExt, path); err != nil {
+		return
+	}
+
+	s.segments = append(s.segments, seg)
+	s.size += size
+	return
+}
+
+// Peek 读取最旧的分段, 分段不存在时 ok 为 false. 分段内容无法解码时返回的错误包含 errCorruptSegment,
+// 其余错误为读取文件时的错误, 可能在之后重试时恢复.
+func (s *spool) Peek() (seg segment, messages []Message, ok bool, err error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	seg, ok = s.segments[0], true
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, seg.name))
+	if err != nil {
+		return
+	}
+	if messages, err = decodeSegment(data); err != nil {
+		err = fmt.Errorf("%w: %w", errCorruptSegment, err)
+	}
+	return
+}
+
+func (s *spool) Remove(seg segment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked(seg)
+}
+
+func (s *spool) removeLocked(seg segment) error {
+	for i, item := range s.segments {
+		if item.seq != seg.seq {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, item.name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		s.size -= item.size
+		return nil
+	}
+	return nil
+}
+
+func (s *spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+func encodeSegment(messages []Message) ([]byte, error) {
+	group := &api.LogGroup{Logs: make([]*api.Log, len(messages))}
+	for i, message := range messages {
+		group.Logs[i] = encodeLog(message.joinTags(), true)
+	}
+	return proto.Marshal(group)
+}
+
+func decodeSegment(data []byte) (messages []Message, err error) {
+	var group api.LogGroup
+	if err = proto.Unmarshal(data, &group); err != nil {
+		return
+	}
+
+	messages = make([]Message, len(group.Logs))
+	for i, log := range group.Logs {
+		contents := make(map[string]string, len(log.Contents))
+		for _, content := range log.Contents {
+			contents[content.GetKey()] = content.GetValue()
+		}
+		messages[i] = Message{
+			Time:     time.Unix(int64(log.GetTime()), int64(log.GetTimeNs())),
+			Contents: contents,
+		}
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package sls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpool(t *testing.T) {
+	t.Run("append and peek", func(t *testing.T) {
+		s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, ok := peekMessages(t, s)
+		assert.False(t, ok)
+
+		for i := 0; i < 3; i++ {
+			evicted, err := s.Append(makeMessages(i + 1))
+			assert.NoError(t, err)
+			assert.Zero(t, evicted)
+		}
+		assert.Equal(t, 3, s.Len())
+
+		for i := 0; i < 3; i++ {
+			seg, messages, ok, err := s.Peek()
+			if assert.True(t, ok) && assert.NoError(t, err) {
+				assert.Equal(t, makeMessages(i + 1)[i].Contents, messages[i].Contents)
+				assert.Len(t, messages, i+1)
+				assert.NoError(t, s.Remove(seg))
+			}
+		}
+		assert.Zero(t, s.Len())
+		assert.Zero(t, s.size)
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := openSpool(dir, DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		msg := Message{
+			Time:     time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC),
+			Contents: map[string]string{"key": "value"},
+			Tags:     map[string]string{"pod": "a"},
+		}
+		_, err = s.Append([]Message{msg})
+		assert.NoError(t, err)
+		_, err = s.Append(makeMessages(2))
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "1"+segmentExt+tempExt), []byte("x"), 0o644))
+
+		s, err = openSpool(dir, DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 2, s.Len())
+		assert.EqualValues(t, 2, s.seq)
+		assert.NoFileExists(t, filepath.Join(dir, "1"+segmentExt+tempExt))
+
+		messages, ok := peekMessages(t, s)
+		if assert.True(t, ok) && assert.Len(t, messages, 1) {
+			assert.True(t, msg.Time.Equal(messages[0].Time))
+			assert.Equal(t, map[string]string{"key": "value", TagPrefix + "pod": "a"}, messages[0].Contents)
+		}
+
+		_, err = s.Append(makeMessages(1))
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, s.seq)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		data, _ := encodeSegment(makeMessages(2))
+		s, err := openSpool(t.TempDir(), int64(len(data))*2, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for i := 0; i < 2; i++ {
+			evicted, err := s.Append(makeMessages(2))
+			assert.NoError(t, err)
+			assert.Zero(t, evicted)
+		}
+
+		evicted, err := s.Append(makeMessages(2))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, evicted)
+		assert.Equal(t, 2, s.Len())
+		assert.EqualValues(t, 2, s.segments[0].seq)
+
+		_, err = s.Append(makeMessages(100))
+		assert.ErrorIs(t, err, ErrSpoolFull)
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		data, _ := encodeSegment(makeMessages(2))
+		s, err := openSpool(t.TempDir(), int64(len(data))*2, SpoolDropNewest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err := s.Append(makeMessages(2))
+			assert.NoError(t, err)
+		}
+
+		evicted, err := s.Append(makeMessages(2))
+		assert.ErrorIs(t, err, ErrSpoolFull)
+		assert.Zero(t, evicted)
+		assert.Equal(t, 2, s.Len())
+		assert.EqualValues(t, 1, s.segments[0].seq)
+	})
+}
+
+func peekMessages(t *testing.T, s *spool) ([]Message, bool) {
+	_, messages, ok, err := s.Peek()
+	assert.NoError(t, err)
+	return messages, ok
+}
@@ -0,0 +1,80 @@
+package sls
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats 为 Writer 自创建以来的运行统计
+type Stats struct {
+	Written         int64     // 写入的日志条数
+	Filtered        int64     // 被 MessageFilter 过滤掉的日志条数
+	Modified        int64     // 经过 MessageModifier 处理的日志条数
+	Queued          int64     // 进入发送缓存的日志条数
+	Sent            int64     // 发送成功的日志条数, 包括从本地缓存重发成功的日志
+	Failed          int64     // 发送失败且未写入本地缓存的日志条数
+	Dropped         int64     // 因发送缓存已满被丢弃的日志条数
+	Spooled         int64     // 发送失败后写入本地缓存的日志条数
+	Retried         int64     // PutLogs 重试的次数
+	Requests        int64     // PutLogs 请求次数, 包括重试
+	RawBytes        int64     // 发送成功的 LogGroup 编码后的字节数
+	CompressedBytes int64     // 发送成功的请求体压缩后的字节数
+	QueueDepth      int64     // 已进入发送缓存但尚未发送完成的日志条数
+	LastError       error     // 最近一次通过 OnError 报告的错误
+	LastErrorTime   time.Time // 最近一次报告错误的时间
+	LastSuccessTime time.Time // 最近一次发送成功的时间
+}
+
+type errorRecord struct {
+	err  error
+	time time.Time
+}
+
+// stats 由 Writer, asyncWorker 和 sls 共享, 各自更新对应的计数器
+type stats struct {
+	counters
+	written         atomic.Int64
+	filtered        atomic.Int64
+	modified        atomic.Int64
+	dropped         atomic.Int64
+	replayed        atomic.Int64
+	retried         atomic.Int64
+	requests        atomic.Int64
+	rawBytes        atomic.Int64
+	compressedBytes atomic.Int64
+	lastError       atomic.Pointer[errorRecord]
+	lastSuccess     atomic.Int64
+}
+
+func (s *stats) setError(err error) {
+	s.lastError.Store(&errorRecord{err: err, time: time.Now()})
+}
+
+func (s *stats) setSuccess() {
+	s.lastSuccess.Store(time.Now().UnixNano())
+}
+
+func (s *stats) snapshot() (out Stats) {
+	out = Stats{
+		Written:         s.written.Load(),
+		Filtered:        s.filtered.Load(),
+		Modified:        s.modified.Load(),
+		Queued:          s.accepted.Load(),
+		Sent:            s.delivered.Load() + s.replayed.Load(),
+		Failed:          s.failed.Load(),
+		Dropped:         s.dropped.Load(),
+		Spooled:         s.spooled.Load(),
+		Retried:         s.retried.Load(),
+		Requests:        s.requests.Load(),
+		RawBytes:        s.rawBytes.Load(),
+		CompressedBytes: s.compressedBytes.Load(),
+		QueueDepth:      max(s.outstanding(), 0),
+	}
+	if r := s.lastError.Load(); r != nil {
+		out.LastError, out.LastErrorTime = r.err, r.time
+	}
+	if t := s.lastSuccess.Load(); t > 0 {
+		out.LastSuccessTime = time.Unix(0, t)
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package sls
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTime = errors.New("invalid time")
+
+type EpochUnit int
+
+const (
+	EpochAuto    EpochUnit = iota // 按数值大小推断秒, 毫秒, 微秒或纳秒
+	EpochSeconds                  // 秒, 可以带小数, 如 zap 的 1700000000.123
+	EpochMillis                   // 毫秒
+	EpochMicros                   // 微秒
+	EpochNanos                    // 纳秒
+)
+
+type InvalidTimePolicy int
+
+const (
+	InvalidTimeReject InvalidTimePolicy = iota // 返回错误, 丢弃这条日志
+	InvalidTimeKeep                            // 使用当前时间, 将原始值保留为普通字段
+	InvalidTimeNow                             // 使用当前时间, 删除时间字段
+)
+
+// TimeOptions 控制如何从日志字段中提取日志时间, 未找到时间字段时使用当前时间
+type TimeOptions struct {
+	Keys     []string          // 时间字段名, 使用第一个存在的字段, 可选, 默认为 ["time"]
+	Layouts  []string          // 字符串时间的格式, 依次尝试, 均不匹配时尝试按数值解析, 可选, 默认为 time.RFC3339Nano
+	Epoch    EpochUnit         // 数值时间的单位, 可选, 默认按数值大小推断
+	Location *time.Location    // 不含时区的时间格式所使用的时区, 可选, 默认为 UTC
+	Invalid  InvalidTimePolicy // 时间字段无法解析时的处理策略, 可选, 默认丢弃这条日志并返回错误
+}
+
+var defaultTimeOptions = &TimeOptions{}
+
+// extractTime 从 fields 中查找时间字段并用 parse 解析, 成功时删除该字段
+func extractTime[V any](o *TimeOptions, fields map[string]V, parse func(o *TimeOptions, value V) (time.Time, error)) (t time.Time, err error) {
+	if o == nil {
+		o = defaultTimeOptions
+	}
+
+	keys := o.Keys
+	if len(keys) == 0 {
+		keys = []string{slog.TimeKey}
+	}
+
+	for _, key := range keys {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		if t, err = parse(o, value); err == nil {
+			delete(fields, key)
+			return
+		}
+
+		switch o.Invalid {
+		case InvalidTimeKeep:
+		case InvalidTimeNow:
+			delete(fields, key)
+		default:
+			return t, fmt.Errorf("field %q: %w", key, err)
+		}
+		return time.Now(), nil
+	}
+	return time.Now(), nil
+}
+
+func (o *TimeOptions) parseJSON(raw json.RawMessage) (time.Time, error) {
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		return time.Now(), nil
+	case raw[0] == '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return time.Time{}, err
+		}
+		return o.Parse(s)
+	default:
+		return o.parseEpoch(string(raw))
+	}
+}
+
+// Parse 按 Layouts 解析时间, 均不匹配时按 Epoch 解析数值时间
+func (o *TimeOptions) Parse(value string) (time.Time, error) {
+	if o == nil {
+		o = defaultTimeOptions
+	}
+
+	layouts := o.Layouts
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339Nano}
+	}
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := o.parseEpoch(value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidTime, value)
+}
+
+func (o *TimeOptions) parseEpoch(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	var (
+		n   float64
+		i   int64
+		err error
+	)
+	isFloat := strings.ContainsAny(value, ".eE")
+	if isFloat {
+		n, err = strconv.ParseFloat(value, 64)
+	} else {
+		i, err = strconv.ParseInt(value, 10, 64)
+		n = float64(i)
+	}
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidTime, value)
+	}
+
+	unit := o.Epoch
+	if unit == EpochAuto {
+		switch abs := math.Abs(n); {
+		case abs < 1e11:
+			unit = EpochSeconds
+		case abs < 1e14:
+			unit = EpochMillis
+		case abs < 1e17:
+			unit = EpochMicros
+		default:
+			unit = EpochNanos
+		}
+	}
+
+	if !isFloat {
+		switch unit {
+		case EpochSeconds:
+			return time.Unix(i, 0), nil
+		case EpochMillis:
+			return time.UnixMilli(i), nil
+		case EpochMicros:
+			return time.UnixMicro(i), nil
+		default:
+			return time.Unix(0, i), nil
+		}
+	}
+
+	switch unit {
+	case EpochMillis:
+		n /= 1e3
+	case EpochMicros:
+		n /= 1e6
+	case EpochNanos:
+		n /= 1e9
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+}
@@ -0,0 +1,124 @@
+package sls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeOptions(t *testing.T) {
+	expected := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	decode := func(raw string, opts *TimeOptions) (Message, error) {
+		var msg Message
+		err := msg.decode([]byte(raw), nil, opts)
+		return msg, err
+	}
+
+	t.Run("default", func(t *testing.T) {
+		msg, err := decode(`{"time":"2023-11-14T22:13:20.5Z","msg":"hello"}`, nil)
+		require.NoError(t, err)
+		assert.True(t, expected.Add(500*time.Millisecond).Equal(msg.Time))
+		assert.Equal(t, map[string]string{"msg": "hello"}, msg.Contents)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		start := time.Now()
+		msg, err := decode(`{"msg":"hello"}`, nil)
+		require.NoError(t, err)
+		assert.False(t, msg.Time.Before(start))
+	})
+
+	t.Run("null", func(t *testing.T) {
+		start := time.Now()
+		msg, err := decode(`{"time":null}`, nil)
+		require.NoError(t, err)
+		assert.False(t, msg.Time.Before(start))
+		assert.Empty(t, msg.Contents)
+	})
+
+	t.Run("epoch", func(t *testing.T) {
+		tests := []struct {
+			name string
+			raw  string
+			opts *TimeOptions
+			want time.Time
+		}{
+			{"zap float seconds", `{"ts":1700000000.25}`, &TimeOptions{Keys: []string{"ts"}}, expected.Add(250 * time.Millisecond)},
+			{"zerolog seconds", `{"time":1700000000}`, nil, expected},
+			{"millis", `{"time":1700000000123}`, nil, expected.Add(123 * time.Millisecond)},
+			{"micros", `{"time":1700000000123456}`, nil, expected.Add(123456 * time.Microsecond)},
+			{"nanos", `{"time":1700000000123456789}`, nil, expected.Add(123456789)},
+			{"string", `{"time":"1700000000123"}`, nil, expected.Add(123 * time.Millisecond)},
+			{"explicit unit", `{"time":1700000000}`, &TimeOptions{Epoch: EpochMillis}, time.UnixMilli(1700000000)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				msg, err := decode(tt.raw, tt.opts)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want.UnixNano(), msg.Time.UnixNano())
+				assert.Empty(t, msg.Contents)
+			})
+		}
+	})
+
+	t.Run("layouts", func(t *testing.T) {
+		opts := &TimeOptions{
+			Keys:    []string{"time_local"},
+			Layouts: []string{"02/Jan/2006:15:04:05 -0700"},
+		}
+		msg, err := decode(`{"time_local":"15/Nov/2023:06:13:20 +0800"}`, opts)
+		require.NoError(t, err)
+		assert.True(t, expected.Equal(msg.Time))
+	})
+
+	t.Run("location", func(t *testing.T) {
+		loc := time.FixedZone("CST", 8*60*60)
+		opts := &TimeOptions{Layouts: []string{time.DateTime}, Location: loc}
+		msg, err := decode(`{"time":"2023-11-15 06:13:20"}`, opts)
+		require.NoError(t, err)
+		assert.True(t, expected.Equal(msg.Time))
+	})
+
+	t.Run("keys order", func(t *testing.T) {
+		opts := &TimeOptions{Keys: []string{"@timestamp", "ts"}}
+		msg, err := decode(`{"ts":1,"@timestamp":1700000000}`, opts)
+		require.NoError(t, err)
+		assert.True(t, expected.Equal(msg.Time))
+		assert.Equal(t, map[string]string{"ts": "1"}, msg.Contents)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		const raw = `{"time":"yesterday","msg":"hello"}`
+
+		_, err := decode(raw, nil)
+		assert.ErrorIs(t, err, ErrInvalidTime)
+
+		start := time.Now()
+		msg, err := decode(raw, &TimeOptions{Invalid: InvalidTimeKeep})
+		require.NoError(t, err)
+		assert.False(t, msg.Time.Before(start))
+		assert.Equal(t, "yesterday", msg.Contents["time"])
+
+		msg, err = decode(raw, &TimeOptions{Invalid: InvalidTimeNow})
+		require.NoError(t, err)
+		assert.False(t, msg.Time.Before(start))
+		assert.Equal(t, map[string]string{"msg": "hello"}, msg.Contents)
+	})
+}
+
+func TestTimeOptionsParse(t *testing.T) {
+	var opts *TimeOptions
+
+	ts, err := opts.Parse("2023-11-14T22:13:20Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), ts.Unix())
+
+	_, err = opts.Parse("")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+
+	_, err = opts.Parse("NaN")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+}
@@ -1,6 +1,7 @@
 package sls
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -31,12 +32,17 @@ type MessageFilter interface {
 	Filter(msg Message) bool
 }
 
-type sender interface {
-	Send(messages ...Message) error
+// Sender 将一批日志发送到后端, 由 Writer 的发送协程调用, Concurrency 大于 1 时可能被并发调用.
+// ctx 在 Shutdown 超时后取消, Shutdown 会等待 Send 返回, 因此 Send 应在 ctx 取消后尽快返回.
+// 返回的错误满足 IsRetryable 且启用了本地缓存时, 这批日志会写入本地缓存稍后重发.
+// 只有部分日志未送达时可以返回 *SendError, 此时只有其中的 Failed 按上述规则处理, 其余日志计为已送达.
+type Sender interface {
+	Send(ctx context.Context, messages ...Message) error
 }
 
 type worker interface {
 	Start()
-	Stop()
+	Stop(ctx context.Context) error
 	Submit(msg Message) error
+	Flush(ctx context.Context) error
 }
@@ -1,33 +1,100 @@
 package sls
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gota33/aliyun-log-writer/internal/validator"
 )
 
 var (
-	ErrClosed = errors.New("write to closed writer")
+	ErrClosed     = errors.New("write to closed writer")
+	ErrBufferFull = errors.New("buffer is full")
 )
 
 type ErrorListener func(err error)
 
+// ShutdownError 汇总关闭期间未能送达的日志
+type ShutdownError struct {
+	Delivered int64 // 关闭期间发送成功的日志条数
+	Failed    int64 // 关闭期间发送失败的日志条数
+	Spooled   int64 // 关闭期间发送失败并写入本地缓存的日志条数
+	Abandoned int64 // 关闭超时后未发送或发送被中止的日志条数
+	Err       error // 关闭超时时为 ctx.Err()
+}
+
+func (e *ShutdownError) Error() string {
+	msg := fmt.Sprintf("shutdown: %d delivered, %d failed, %d spooled, %d abandoned",
+		e.Delivered, e.Failed, e.Spooled, e.Abandoned)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+type OverflowPolicy int
+
+const (
+	OverflowBlock        OverflowPolicy = iota // 阻塞等待直到缓存有空位
+	OverflowBlockTimeout                       // 阻塞等待直到缓存有空位或超时, 超时后丢弃新日志
+	OverflowDropNewest                         // 不等待, 丢弃新日志
+	OverflowDropOldest                         // 不等待, 丢弃缓存中最旧的日志
+)
+
 type workerOption struct {
-	bufferSize int
-	interval   time.Duration
-	onError    ErrorListener
-	client     sender
+	bufferSize      int
+	batchBytes      int
+	linger          time.Duration
+	interval        time.Duration
+	overflow        OverflowPolicy
+	overflowTimeout time.Duration
+	concurrency     int
+	partitionKey    string
+	onError         ErrorListener
+	client          Sender
+	spool           *spool
+	stats           *stats
+}
+
+// counters 记录日志的处理结果, 关闭时据此统计未送达的日志
+type counters struct {
+	accepted  atomic.Int64
+	delivered atomic.Int64
+	failed    atomic.Int64
+	spooled   atomic.Int64
+	abandoned atomic.Int64
+	evicted   atomic.Int64
+}
+
+func (c *counters) outstanding() int64 {
+	return c.accepted.Load() - c.delivered.Load() - c.failed.Load() -
+		c.spooled.Load() - c.abandoned.Load() - c.evicted.Load()
 }
 
 type asyncWorker struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
 	chData    chan Message
+	chFlush   chan flushRequest
+	lanes     []chan *job
+	jobsMu    *sync.Mutex
+	jobs      map[*job]struct{}
 	startFunc *sync.Once
 	closeFunc *sync.Once
 	wgRunning *sync.WaitGroup
+	submitMu  *sync.RWMutex
+	closed    bool
 	chQuit    chan struct{}
-	chSubmit  chan struct{}
+	chStop    chan struct{}
+	dropped   *atomic.Int64
 	workerOption
 }
 
@@ -37,13 +104,39 @@ func newWorker(opt workerOption) worker {
 		startFunc:    &sync.Once{},
 		closeFunc:    &sync.Once{},
 		wgRunning:    &sync.WaitGroup{},
-		chSubmit:     make(chan struct{}),
+		submitMu:     &sync.RWMutex{},
+		chFlush:      make(chan flushRequest),
+		jobsMu:       &sync.Mutex{},
+		jobs:         make(map[*job]struct{}),
 		chQuit:       make(chan struct{}),
+		chStop:       make(chan struct{}),
+		dropped:      &atomic.Int64{},
+	}
+
+	if w.stats == nil {
+		w.stats = &stats{}
 	}
 
+	// ctx 在关闭超时后取消, 中止进行中的发送和重试
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
 	w.bufferSize = validator.Coalesce(opt.bufferSize, DefaultBufferSize)
 	w.interval = validator.Coalesce(opt.interval, DefaultInterval)
+	w.batchBytes = validator.Coalesce(opt.batchBytes, DefaultBatchBytes)
+	w.linger = validator.Coalesce(opt.linger, w.interval)
+	w.overflowTimeout = validator.Coalesce(opt.overflowTimeout, DefaultTimeout)
+	w.concurrency = validator.Coalesce(opt.concurrency, 1)
 	w.chData = make(chan Message, 2*w.bufferSize)
+
+	// 未指定分区字段时所有发送协程共用一个队列, 否则每个分区由一个发送协程按序发送
+	lanes := 1
+	if w.partitionKey != "" {
+		lanes = w.concurrency
+	}
+	w.lanes = make([]chan *job, lanes)
+	for i := range w.lanes {
+		w.lanes[i] = make(chan *job)
+	}
 	return w
 }
 
@@ -54,91 +147,506 @@ func (w *asyncWorker) Start() {
 			defer w.wgRunning.Done()
 			w.run()
 		}()
+
+		for i := 0; i < w.concurrency; i++ {
+			lane := w.lanes[i%len(w.lanes)]
+			w.wgRunning.Add(1)
+			go func() {
+				defer w.wgRunning.Done()
+				for j := range lane {
+					j.err = w.flush(j.messages)
+					w.untrack(j)
+					close(j.done)
+				}
+			}()
+		}
+
+		if w.spool != nil {
+			w.wgRunning.Add(1)
+			go func() {
+				defer w.wgRunning.Done()
+				w.runReplay()
+			}()
+		}
 	})
 }
 
+type batch struct {
+	messages []Message
+	bytes    int
+	deadline time.Time
+}
+
+// job 为交给发送协程的一批日志, 发送完成后关闭 done
+type job struct {
+	messages []Message
+	done     chan struct{}
+	err      error
+}
+
+type flushRequest struct {
+	jobs chan []*job
+}
+
+// run 从缓存中读取日志, 按分区组成批次, 在批次条数达到 bufferSize, 字节数达到 batchBytes,
+// 或第一条日志等待超过 linger 时交给发送协程. 发送协程全部繁忙时 run 阻塞, 缓存随之积压.
 func (w *asyncWorker) run() {
 	ticker := time.NewTicker(w.interval)
 	defer ticker.Stop()
 
-	for running := true; running; {
+	defer func() {
+		for _, lane := range w.lanes {
+			close(lane)
+		}
+	}()
+
+	var (
+		batches = make([]batch, len(w.lanes))
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+
+	// resetTimer 将定时器设置为最早到期的批次
+	resetTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+
+		var next time.Time
+		for _, b := range batches {
+			if len(b.messages) > 0 && (next.IsZero() || b.deadline.Before(next)) {
+				next = b.deadline
+			}
+		}
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+	}
+
+	dispatch := func(i int) {
+		if len(batches[i].messages) > 0 {
+			j := &job{messages: batches[i].messages, done: make(chan struct{})}
+			w.track(j)
+			w.lanes[i] <- j
+		}
+		batches[i] = batch{}
+	}
+
+	add := func(msg Message) {
+		i := w.partition(msg)
+		b := &batches[i]
+		if len(b.messages) == 0 {
+			b.deadline = time.Now().Add(w.linger)
+		}
+
+		b.messages = append(b.messages, msg)
+		b.bytes += msg.size()
+		if len(b.messages) >= w.bufferSize || b.bytes >= w.batchBytes {
+			dispatch(i)
+			resetTimer()
+		} else if timeout == nil {
+			resetTimer()
+		}
+	}
+
+	for {
 		select {
-		case <-w.chQuit:
-			running = false
-		case <-w.chSubmit:
-			w.flush(w.chData, w.bufferSize)
+		case msg := <-w.chData:
+			add(msg)
+		case now := <-timeout:
+			timer, timeout = nil, nil
+			for i, b := range batches {
+				if len(b.messages) > 0 && !b.deadline.After(now) {
+					dispatch(i)
+				}
+			}
+			resetTimer()
+		case req := <-w.chFlush:
+			// 调用 Flush 之前提交的日志都已在缓存中
+			w.drain(add)
+			for i := range batches {
+				dispatch(i)
+			}
+			resetTimer()
+			req.jobs <- w.pendingJobs()
 		case <-ticker.C:
-			w.flush(w.chData, 1)
+			w.reportDropped()
+		case <-w.chStop:
+			logger.Printf("Remain: %d", len(w.chData))
+			w.drain(add)
+			if timer != nil {
+				timer.Stop()
+			}
+			for i := range batches {
+				dispatch(i)
+			}
+			w.reportDropped()
+			return
 		}
 	}
+}
 
-	ch := w.chData
-	w.chData = make(chan Message)
+// drain 取出缓存中现有的日志
+func (w *asyncWorker) drain(add func(msg Message)) {
+	for n := len(w.chData); n > 0; n-- {
+		select {
+		case msg := <-w.chData:
+			add(msg)
+		default:
+			return
+		}
+	}
+}
 
-	logger.Printf("Remain: %d", len(ch))
-	w.flush(ch, 1)
+func (w *asyncWorker) track(j *job) {
+	w.jobsMu.Lock()
+	defer w.jobsMu.Unlock()
+	w.jobs[j] = struct{}{}
 }
 
-func (w *asyncWorker) Submit(msg Message) (err error) {
+func (w *asyncWorker) untrack(j *job) {
+	w.jobsMu.Lock()
+	defer w.jobsMu.Unlock()
+	delete(w.jobs, j)
+}
+
+func (w *asyncWorker) pendingJobs() []*job {
+	w.jobsMu.Lock()
+	defer w.jobsMu.Unlock()
+
+	jobs := make([]*job, 0, len(w.jobs))
+	for j := range w.jobs {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// Flush 立即发送调用前提交的所有日志, 等待发送完成并返回其中的错误
+func (w *asyncWorker) Flush(ctx context.Context) error {
+	req := flushRequest{jobs: make(chan []*job, 1)}
 	select {
 	case <-w.chQuit:
 		return ErrClosed
-	case w.chData <- msg:
+	case <-ctx.Done():
+		return ctx.Err()
+	case w.chFlush <- req:
+	}
+
+	var jobs []*job
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case jobs = <-req.jobs:
+	}
+
+	errs := make([]error, 0, len(jobs))
+	for _, j := range jobs {
 		select {
-		case w.chSubmit <- struct{}{}:
-		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-j.done:
+			errs = append(errs, j.err)
 		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *asyncWorker) partition(msg Message) int {
+	if len(w.lanes) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(msg.Contents[w.partitionKey]))
+	return int(h.Sum32() % uint32(len(w.lanes)))
+}
+
+func (w *asyncWorker) Submit(msg Message) (err error) {
+	w.submitMu.RLock()
+	defer w.submitMu.RUnlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	if err = w.enqueue(msg); err == nil {
+		w.stats.accepted.Add(1)
 		logger.Printf("Submit: %v", msg)
 	}
 	return
 }
 
-func (w *asyncWorker) Stop() {
+func (w *asyncWorker) enqueue(msg Message) error {
+	select {
+	case <-w.chQuit:
+		return ErrClosed
+	default:
+	}
+
+	switch w.overflow {
+	case OverflowDropNewest:
+		select {
+		case w.chData <- msg:
+			return nil
+		default:
+			w.dropped.Add(1)
+			w.stats.dropped.Add(1)
+			return ErrBufferFull
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.chData <- msg:
+				return nil
+			default:
+			}
+
+			select {
+			case <-w.chData:
+				w.dropped.Add(1)
+				w.stats.dropped.Add(1)
+				w.stats.evicted.Add(1)
+			default:
+			}
+		}
+	case OverflowBlockTimeout:
+		timer := time.NewTimer(w.overflowTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-w.chQuit:
+			return ErrClosed
+		case w.chData <- msg:
+			return nil
+		case <-timer.C:
+			w.dropped.Add(1)
+			w.stats.dropped.Add(1)
+			return ErrBufferFull
+		}
+	default:
+		select {
+		case <-w.chQuit:
+			return ErrClosed
+		case w.chData <- msg:
+			return nil
+		}
+	}
+}
+
+// reportDropped 汇总上次报告以来因缓存已满丢弃的日志条数
+func (w *asyncWorker) reportDropped() {
+	if n := w.dropped.Swap(0); n > 0 {
+		w.report(fmt.Errorf("%w: %d messages dropped", ErrBufferFull, n))
+	}
+}
+
+// Stop 停止接收新日志并发送缓存中的日志, ctx 结束时中止发送, 等待发送协程处理完被中止的日志后返回,
+// 因此 Sender 应在 ctx 取消后尽快返回. 存在未送达的日志时返回 *ShutdownError.
+func (w *asyncWorker) Stop(ctx context.Context) error {
+	c := w.stats
+	delivered, failed, spooled, abandoned := c.delivered.Load(), c.failed.Load(), c.spooled.Load(), c.abandoned.Load()
+
 	w.closeFunc.Do(func() {
+		// 先唤醒阻塞中的 Submit, 等待进行中的 Submit 全部返回后再通知 run 清空缓存
 		close(w.chQuit)
+		w.submitMu.Lock()
+		w.closed = true
+		w.submitMu.Unlock()
+		close(w.chStop)
 	})
-	w.wgRunning.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		w.wgRunning.Wait()
+		close(done)
+	}()
+
+	var ctxErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+		// 中止进行中的发送和重发, 等待发送协程将未送达的日志写入本地缓存后再返回
+		w.cancel()
+		<-done
+	}
+	w.cancel()
+
+	e := &ShutdownError{
+		Delivered: c.delivered.Load() - delivered,
+		Failed:    c.failed.Load() - failed,
+		Spooled:   c.spooled.Load() - spooled,
+		Abandoned: c.abandoned.Load() - abandoned + c.outstanding(),
+		Err:       ctxErr,
+	}
+	logger.Printf("Stop: %v", e)
+	if e.Failed > 0 || e.Spooled > 0 || e.Abandoned > 0 || e.Err != nil {
+		return e
+	}
+	return nil
 }
 
-func (w *asyncWorker) flush(chData <-chan Message, atLeast int) {
-	for {
-		messages := w.takeAtLeast(chData, atLeast)
-		if size := len(messages); size == 0 {
-			return
+func (w *asyncWorker) flush(messages []Message) (err error) {
+	if len(messages) == 0 {
+		return
+	}
+
+	if err = w.client.Send(w.ctx, messages...); err != nil {
+		err = w.fail(messages, err)
+	} else {
+		w.stats.delivered.Add(int64(len(messages)))
+		w.stats.setSuccess()
+	}
+
+	if debugMode {
+		logger.Printf("Flush %d messages", len(messages))
+		for i, message := range messages {
+			logger.Printf("Flush[%d]: %v", i, message)
 		}
+	}
+	return
+}
 
-		if err := w.client.Send(messages...); err != nil && w.onError != nil {
-			w.onError(err)
+// fail 处理发送失败的日志, 启用本地缓存时将可重试或因关闭超时被中止的日志写入缓存稍后重发.
+// err 为 *SendError 时已送达的日志计入送达, 只处理其中未送达的日志.
+func (w *asyncWorker) fail(messages []Message, err error) error {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		if delivered := len(messages) - len(sendErr.Failed) - sendErr.Rejected; delivered > 0 {
+			w.stats.delivered.Add(int64(delivered))
+			w.stats.setSuccess()
 		}
+		w.stats.failed.Add(int64(sendErr.Rejected))
+		if messages = sendErr.Failed; len(messages) == 0 {
+			w.report(err)
+			return err
+		}
+	}
 
-		if debugMode {
-			logger.Printf("Flush %d messages", len(messages))
-			for i, message := range messages {
-				logger.Printf("Flush[%d]: %v", i, message)
+	n := int64(len(messages))
+	aborted := w.ctx.Err() != nil
+
+	if w.spool != nil && (aborted || IsRetryable(err)) {
+		evicted, sErr := w.spool.Append(messages)
+		if sErr != nil {
+			err = errors.Join(err, fmt.Errorf("spool %d messages: %w", len(messages), sErr))
+		} else {
+			w.stats.spooled.Add(n)
+			err = fmt.Errorf("%w (%d messages spooled)", err, len(messages))
+		}
+		if evicted > 0 {
+			err = errors.Join(err, fmt.Errorf("%w: %d spooled messages evicted", ErrSpoolFull, evicted))
+		}
+		if sErr == nil {
+			if !aborted {
+				w.report(err)
 			}
+			return err
 		}
 	}
+
+	if aborted {
+		// 关闭超时, 由 Stop 统一报告
+		w.stats.abandoned.Add(n)
+		return err
+	}
+
+	w.stats.failed.Add(n)
+	w.report(err)
+	return err
 }
 
-func (w *asyncWorker) takeAtLeast(chData <-chan Message, atLeast int) (msgs []Message) {
-	size := len(chData)
-	if size < atLeast {
-		return
+func (w *asyncWorker) report(err error) {
+	w.stats.setError(err)
+	if w.onError != nil {
+		w.onError(err)
 	}
+}
+
+func (w *asyncWorker) runReplay() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
 
-	if size > w.bufferSize {
-		size = w.bufferSize
+	for {
+		w.replay()
+
+		select {
+		case <-w.chQuit:
+			return
+		case <-ticker.C:
+		}
 	}
-loop:
-	for i := 0; i < size; i++ {
+}
+
+// replay 按顺序重发本地缓存中的日志, 遇到可重试的错误时停止, 等待下次重发
+func (w *asyncWorker) replay() {
+	for {
 		select {
-		case msg := <-chData:
-			logger.Printf("Pull: %v", msg)
-			msgs = append(msgs, msg)
+		case <-w.chQuit:
+			return
 		default:
-			break loop
+		}
+
+		seg, messages, ok, err := w.spool.Peek()
+		if !ok {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, errCorruptSegment) && !errors.Is(err, os.ErrNotExist) {
+				// 读取失败可能是暂时的, 如文件句柄耗尽, 保留分段等待下次重发
+				w.report(fmt.Errorf("read spool segment %q: %w", seg.name, err))
+				return
+			}
+			w.report(fmt.Errorf("drop spool segment %q: %w", seg.name, err))
+		} else if err = w.client.Send(w.ctx, messages...); err != nil {
+			if !w.replayFailed(seg, messages, err) {
+				return
+			}
+		} else {
+			w.stats.replayed.Add(int64(len(messages)))
+			w.stats.setSuccess()
+			logger.Printf("Replay %d messages from %q", len(messages), seg.name)
+		}
+
+		if err = w.spool.Remove(seg); err != nil {
+			w.report(err)
+			return
 		}
 	}
-	logger.Printf("Pull %d messages", len(msgs))
-	return
+}
+
+// replayFailed 处理重发失败的分段, 返回 false 时保留该分段等待下次重发.
+// 部分日志已送达时将其余可重试的日志写入新的分段, 避免重发已送达的日志.
+func (w *asyncWorker) replayFailed(seg segment, messages []Message, err error) bool {
+	failed := messages
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		failed = sendErr.Failed
+		if replayed := len(messages) - len(failed) - sendErr.Rejected; replayed > 0 {
+			w.stats.replayed.Add(int64(replayed))
+			w.stats.setSuccess()
+		}
+	}
+
+	// 关闭超时中止的重发与可重试的错误相同, 保留日志等待下次启动时重发
+	retryable := w.ctx.Err() != nil || IsRetryable(err)
+	if !retryable || len(failed) == 0 {
+		w.report(fmt.Errorf("drop spool segment %q: %w", seg.name, err))
+		return true
+	}
+	if len(failed) == len(messages) {
+		logger.Printf("Replay %q: %v", seg.name, err)
+		return false
+	}
+
+	evicted, sErr := w.spool.Append(failed)
+	if sErr != nil {
+		w.report(fmt.Errorf("respool %d messages from %q: %w", len(failed), seg.name, sErr))
+		return false
+	}
+	if evicted > 0 {
+		w.report(fmt.Errorf("%w: %d spooled messages evicted", ErrSpoolFull, evicted))
+	}
+	logger.Printf("Replay %q: %d messages respooled: %v", seg.name, len(failed), err)
+	return true
 }
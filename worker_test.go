@@ -1,8 +1,17 @@
 package sls
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -40,12 +49,159 @@ func TestWorker(t *testing.T) {
 			}
 		}
 
-		w.Stop()
+		assert.NoError(t, w.Stop(context.Background()))
 
 		assert.EqualValues(t, deliverSize, client.total)
 		assert.GreaterOrEqual(t, client.batch, batchSize)
 	})
 
+	t.Run("batch bytes", func(t *testing.T) {
+		messages := makeMessages(9)
+		client := &MockSender{}
+
+		w := newWorker(workerOption{
+			bufferSize: 100,
+			batchBytes: 3 * messages[0].size(),
+			linger:     time.Hour,
+			client:     client,
+		})
+		w.Start()
+
+		for _, msg := range messages {
+			assert.NoError(t, w.Submit(msg))
+		}
+
+		assert.NoError(t, w.Stop(context.Background()))
+		assert.Equal(t, []int{3, 3, 3}, client.sizes)
+	})
+
+	t.Run("linger", func(t *testing.T) {
+		client := &SwitchSender{}
+
+		w := newWorker(workerOption{
+			bufferSize: 100,
+			linger:     20 * time.Millisecond,
+			interval:   time.Hour,
+			client:     client,
+		})
+		w.Start()
+
+		for _, msg := range makeMessages(5) {
+			assert.NoError(t, w.Submit(msg))
+		}
+		assert.Eventually(t, func() bool { return client.count() == 5 }, time.Second, time.Millisecond)
+
+		assert.NoError(t, w.Stop(context.Background()))
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		const (
+			total       = 40
+			concurrency = 4
+		)
+		client := &SlowSender{delay: 5 * time.Millisecond}
+
+		w := newWorker(workerOption{
+			bufferSize:  1,
+			concurrency: concurrency,
+			client:      client,
+		})
+		w.Start()
+
+		for _, msg := range makeMessages(total) {
+			assert.NoError(t, w.Submit(msg))
+		}
+
+		assert.NoError(t, w.Stop(context.Background()))
+		assert.Len(t, client.received, total)
+		assert.Greater(t, client.maxInflight, int32(1))
+		assert.LessOrEqual(t, client.maxInflight, int32(concurrency))
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		const (
+			total = 100
+			keys  = 5
+		)
+		client := &SlowSender{delay: time.Millisecond}
+
+		w := newWorker(workerOption{
+			bufferSize:   3,
+			concurrency:  4,
+			partitionKey: "key",
+			client:       client,
+		})
+		w.Start()
+
+		for i, msg := range makeMessages(total) {
+			msg.Contents["key"] = strconv.Itoa(i % keys)
+			assert.NoError(t, w.Submit(msg))
+		}
+
+		assert.NoError(t, w.Stop(context.Background()))
+		assert.Len(t, client.received, total)
+
+		last := make(map[string]int)
+		for _, msg := range client.received {
+			no, _ := strconv.Atoi(msg.Contents["no"])
+			if prev, ok := last[msg.Contents["key"]]; ok {
+				assert.Greater(t, no, prev)
+			}
+			last[msg.Contents["key"]] = no
+		}
+		assert.Len(t, last, keys)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		client := &SwitchSender{}
+
+		w := newWorker(workerOption{
+			bufferSize:  100,
+			linger:      time.Hour,
+			concurrency: 2,
+			client:      client,
+		})
+		w.Start()
+		defer func() { _ = w.Stop(context.Background()) }()
+
+		for round := 1; round <= 3; round++ {
+			for _, msg := range makeMessages(5) {
+				assert.NoError(t, w.Submit(msg))
+			}
+			assert.NoError(t, w.Flush(context.Background()))
+			assert.Equal(t, 5*round, client.count())
+		}
+
+		client.setError(errors.New("test error"))
+		assert.NoError(t, w.Submit(Message{}))
+		assert.ErrorIs(t, w.Flush(context.Background()), client.err)
+
+		assert.NoError(t, w.Flush(context.Background()))
+	})
+
+	t.Run("flush timeout", func(t *testing.T) {
+		w := newWorker(workerOption{
+			bufferSize: 100,
+			linger:     time.Hour,
+			client:     &SlowSender{delay: 100 * time.Millisecond},
+		})
+		w.Start()
+		defer func() { _ = w.Stop(context.Background()) }()
+
+		assert.NoError(t, w.Submit(Message{}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, w.Flush(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("flush after closed", func(t *testing.T) {
+		w := newWorker(workerOption{client: &MockSender{}})
+		w.Start()
+		assert.NoError(t, w.Stop(context.Background()))
+		assert.ErrorIs(t, w.Flush(context.Background()), ErrClosed)
+	})
+
 	t.Run("onError", func(t *testing.T) {
 		const total = 10
 		count := &atomic.Int64{}
@@ -66,8 +222,350 @@ func TestWorker(t *testing.T) {
 			assert.NoError(t, err)
 		}
 
-		w.Stop()
+		var shutdownErr *ShutdownError
+		if assert.ErrorAs(t, w.Stop(context.Background()), &shutdownErr) {
+			assert.Positive(t, shutdownErr.Failed)
+			assert.Zero(t, shutdownErr.Abandoned)
+			assert.NoError(t, shutdownErr.Err)
+		}
 		assert.EqualValues(t, client.batch, count.Load())
+
+		st := w.stats.snapshot()
+		assert.EqualValues(t, total, st.Queued)
+		assert.EqualValues(t, total, st.Failed)
+		assert.Zero(t, st.Sent)
+		assert.Zero(t, st.QueueDepth)
+		assert.ErrorIs(t, st.LastError, client.err)
+		assert.False(t, st.LastErrorTime.IsZero())
+	})
+
+	t.Run("spool", func(t *testing.T) {
+		const total = 10
+		s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		client := &SwitchSender{err: &AliyunError{Code: "ServerBusy"}}
+		errCount := &atomic.Int64{}
+
+		w := newWorker(workerOption{
+			bufferSize: 2,
+			interval:   10 * time.Millisecond,
+			onError:    func(err error) { errCount.Add(1) },
+			client:     client,
+			spool:      s,
+		})
+		w.Start()
+
+		for _, msg := range makeMessages(total) {
+			assert.NoError(t, w.Submit(msg))
+		}
+		assert.Eventually(t, func() bool { return s.Len() > 0 }, time.Second, time.Millisecond)
+
+		client.setError(nil)
+		assert.Eventually(t, func() bool { return client.count() == total }, time.Second, time.Millisecond)
+
+		assert.NoError(t, w.Stop(context.Background()))
+		assert.Zero(t, s.Len())
+		assert.Positive(t, errCount.Load())
+
+		st := w.(*asyncWorker).stats.snapshot()
+		assert.EqualValues(t, total, st.Sent)
+		assert.Positive(t, st.Spooled)
+		assert.False(t, st.LastSuccessTime.IsZero())
+	})
+
+	t.Run("replay errors", func(t *testing.T) {
+		s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = s.Append(makeMessages(2))
+		assert.NoError(t, err)
+
+		var errs []error
+		client := &SwitchSender{}
+		w := newWorker(workerOption{
+			client:  client,
+			spool:   s,
+			onError: func(err error) { errs = append(errs, err) },
+		}).(*asyncWorker)
+
+		// 读取失败时保留分段
+		seg := s.segments[0]
+		path := filepath.Join(s.dir, seg.name)
+		assert.NoError(t, os.Rename(path, path+".bak"))
+		assert.NoError(t, os.Mkdir(path, 0o755))
+		w.replay()
+		assert.Equal(t, 1, s.Len())
+		if assert.Len(t, errs, 1) {
+			assert.ErrorContains(t, errs[0], "read spool segment")
+		}
+
+		assert.NoError(t, os.Remove(path))
+		assert.NoError(t, os.Rename(path+".bak", path))
+		w.replay()
+		assert.Zero(t, s.Len())
+		assert.Equal(t, 2, client.count())
+
+		// 内容无法解码时删除分段
+		_, err = s.Append(makeMessages(1))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(s.dir, s.segments[0].name), []byte("corrupt"), 0o644))
+		w.replay()
+		assert.Zero(t, s.Len())
+		if assert.Len(t, errs, 2) {
+			assert.ErrorIs(t, errs[1], errCorruptSegment)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		// 第 2 个请求返回 ServerBusy, 其余请求成功, 记录成功送达的日志条数
+		newServer := func() (*httptest.Server, *atomic.Int64) {
+			requests, logs := &atomic.Int32{}, &atomic.Int64{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if requests.Add(1) == 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					_, _ = w.Write([]byte(`{"errorCode":"ServerBusy","errorMessage":"server busy"}`))
+					return
+				}
+				data, _ := io.ReadAll(req.Body)
+				logs.Add(int64(len(decodeGroup(t, data).Logs)))
+				w.WriteHeader(http.StatusOK)
+			}))
+			return srv, logs
+		}
+		newClient := func(uri string) *sls {
+			u, _ := url.Parse(uri)
+			return &sls{
+				Client:      http.DefaultClient,
+				Credentials: StaticCredentials(DefaultAccessKey, string(DefaultAccessSecret), ""),
+				Uri:         u,
+				Host:        u.Host,
+				Compression: CompressNone,
+			}
+		}
+
+		t.Run("split batch", func(t *testing.T) {
+			const total = MaxLogGroupCount + 2
+			srv, logs := newServer()
+			defer srv.Close()
+
+			s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			w := newWorker(workerOption{
+				bufferSize: total + 1,
+				interval:   time.Hour,
+				client:     newClient(srv.URL),
+				spool:      s,
+			}).(*asyncWorker)
+			w.Start()
+
+			for _, msg := range makeMessages(total) {
+				assert.NoError(t, w.Submit(msg))
+			}
+			assert.Error(t, w.Flush(context.Background()))
+			assert.EqualValues(t, MaxLogGroupCount, logs.Load())
+
+			st := w.stats.snapshot()
+			assert.EqualValues(t, MaxLogGroupCount, st.Sent)
+			assert.EqualValues(t, 2, st.Spooled)
+			assert.Zero(t, st.Failed)
+			assert.Zero(t, st.QueueDepth)
+
+			_, messages, ok, err := s.Peek()
+			if assert.True(t, ok) && assert.NoError(t, err) {
+				assert.Len(t, messages, 2)
+			}
+
+			w.replay()
+			assert.Zero(t, s.Len())
+			assert.EqualValues(t, total, logs.Load())
+			assert.EqualValues(t, total, w.stats.snapshot().Sent)
+			assert.NoError(t, w.Stop(context.Background()))
+		})
+
+		t.Run("rejected", func(t *testing.T) {
+			const total = 10
+			srv, logs := newServer()
+			defer srv.Close()
+
+			client := newClient(srv.URL)
+			client.MaxLogSize, client.Oversize = 1000, OversizeReject
+
+			w := newWorker(workerOption{
+				bufferSize: total + 1,
+				interval:   time.Hour,
+				client:     client,
+			}).(*asyncWorker)
+			w.Start()
+
+			messages := makeMessages(total)
+			messages[3].Contents["large"] = strings.Repeat("x", 2000)
+			for _, msg := range messages {
+				assert.NoError(t, w.Submit(msg))
+			}
+			assert.ErrorIs(t, w.Flush(context.Background()), ErrLogTooLarge)
+			assert.EqualValues(t, total-1, logs.Load())
+
+			st := w.stats.snapshot()
+			assert.EqualValues(t, total-1, st.Sent)
+			assert.EqualValues(t, 1, st.Failed)
+			assert.Zero(t, st.QueueDepth)
+			assert.NoError(t, w.Stop(context.Background()))
+		})
+	})
+
+	t.Run("shutdown timeout", func(t *testing.T) {
+		const total = 5
+		w := newWorker(workerOption{
+			bufferSize: total,
+			interval:   time.Second,
+			client:     &BlockingSender{},
+		})
+		w.Start()
+
+		for _, msg := range makeMessages(total) {
+			assert.NoError(t, w.Submit(msg))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		var shutdownErr *ShutdownError
+		err := w.Stop(ctx)
+		if assert.ErrorAs(t, err, &shutdownErr) {
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.EqualValues(t, total, shutdownErr.Abandoned)
+			assert.Zero(t, shutdownErr.Delivered)
+		}
+	})
+
+	t.Run("shutdown with spool", func(t *testing.T) {
+		const total = 5
+		s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		w := newWorker(workerOption{
+			bufferSize: total,
+			interval:   time.Second,
+			client:     &BlockingSender{},
+			spool:      s,
+		})
+		w.Start()
+
+		for _, msg := range makeMessages(total) {
+			assert.NoError(t, w.Submit(msg))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		var shutdownErr *ShutdownError
+		err = w.Stop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		if assert.ErrorAs(t, err, &shutdownErr) {
+			assert.EqualValues(t, total, shutdownErr.Spooled)
+			assert.Zero(t, shutdownErr.Abandoned)
+		}
+
+		assert.Equal(t, 1, s.Len())
+		_, messages, ok, err := s.Peek()
+		if assert.True(t, ok) && assert.NoError(t, err) {
+			assert.Len(t, messages, total)
+		}
+	})
+
+	t.Run("shutdown during replay", func(t *testing.T) {
+		const total = 3
+		s, err := openSpool(t.TempDir(), DefaultSpoolMaxSize, SpoolDropOldest)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = s.Append(makeMessages(total))
+		assert.NoError(t, err)
+
+		client := &BlockingSender{}
+		w := newWorker(workerOption{
+			interval: time.Second,
+			client:   client,
+			spool:    s,
+		})
+		w.Start()
+		assert.Eventually(t, func() bool { return client.calls.Load() > 0 }, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, w.Stop(ctx), context.DeadlineExceeded)
+
+		_, messages, ok, err := s.Peek()
+		if assert.True(t, ok) && assert.NoError(t, err) {
+			assert.Len(t, messages, total)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		newFullWorker := func(policy OverflowPolicy) *asyncWorker {
+			w := newWorker(workerOption{
+				bufferSize:      1,
+				overflow:        policy,
+				overflowTimeout: 10 * time.Millisecond,
+				client:          &MockSender{},
+			}).(*asyncWorker)
+
+			for _, msg := range makeMessages(cap(w.chData)) {
+				assert.NoError(t, w.Submit(msg))
+			}
+			return w
+		}
+
+		t.Run("block timeout", func(t *testing.T) {
+			w := newFullWorker(OverflowBlockTimeout)
+			err := w.Submit(Message{})
+			assert.ErrorIs(t, err, ErrBufferFull)
+			assert.EqualValues(t, 1, w.dropped.Load())
+		})
+
+		t.Run("drop newest", func(t *testing.T) {
+			w := newFullWorker(OverflowDropNewest)
+			err := w.Submit(Message{})
+			assert.ErrorIs(t, err, ErrBufferFull)
+			assert.EqualValues(t, 1, w.dropped.Load())
+			assert.EqualValues(t, 1, w.stats.snapshot().Dropped)
+			assert.EqualValues(t, cap(w.chData), w.stats.snapshot().QueueDepth)
+		})
+
+		t.Run("drop oldest", func(t *testing.T) {
+			w := newFullWorker(OverflowDropOldest)
+			latest := Message{Contents: map[string]string{"no": "latest"}}
+			assert.NoError(t, w.Submit(latest))
+			assert.EqualValues(t, 1, w.dropped.Load())
+
+			assert.Equal(t, "1", (<-w.chData).Contents["no"])
+			assert.Equal(t, latest, <-w.chData)
+		})
+
+		t.Run("report", func(t *testing.T) {
+			var reported error
+			w := newFullWorker(OverflowDropNewest)
+			w.onError = func(err error) { reported = err }
+
+			_ = w.Submit(Message{})
+			_ = w.Submit(Message{})
+			w.reportDropped()
+			assert.ErrorIs(t, reported, ErrBufferFull)
+			assert.Contains(t, reported.Error(), "2 messages dropped")
+			assert.Zero(t, w.dropped.Load())
+
+			reported = nil
+			w.reportDropped()
+			assert.NoError(t, reported)
+		})
 	})
 
 	t.Run("write after closed", func(t *testing.T) {
@@ -78,7 +576,7 @@ func TestWorker(t *testing.T) {
 			client:     &MockSender{},
 		})
 		w.Start()
-		w.Stop()
+		assert.NoError(t, w.Stop(context.Background()))
 
 		err := w.Submit(Message{})
 		assert.ErrorIs(t, err, ErrClosed)
@@ -88,16 +586,77 @@ func TestWorker(t *testing.T) {
 type MockSender struct {
 	total int
 	batch int
+	sizes []int
 	err   error
 }
 
-func (s *MockSender) Send(messages ...Message) error {
+func (s *MockSender) Send(ctx context.Context, messages ...Message) error {
 	s.total += len(messages)
 	s.batch++
+	s.sizes = append(s.sizes, len(messages))
 	logger.Printf("Total: %d", s.total)
 	return s.err
 }
 
+type SwitchSender struct {
+	mu    sync.Mutex
+	total int
+	err   error
+}
+
+func (s *SwitchSender) Send(ctx context.Context, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.total += len(messages)
+	}
+	return s.err
+}
+
+func (s *SwitchSender) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *SwitchSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// BlockingSender 阻塞直到 ctx 结束
+type BlockingSender struct {
+	calls atomic.Int32
+}
+
+func (s *BlockingSender) Send(ctx context.Context, messages ...Message) error {
+	s.calls.Add(1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type SlowSender struct {
+	delay       time.Duration
+	mu          sync.Mutex
+	received    []Message
+	inflight    atomic.Int32
+	maxInflight int32
+}
+
+func (s *SlowSender) Send(ctx context.Context, messages ...Message) error {
+	n := s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxInflight = max(s.maxInflight, n)
+	s.received = append(s.received, messages...)
+	return nil
+}
+
 func makeMessages(num int) (msgs []Message) {
 	msgs = make([]Message, num)
 	for i := 0; i < num; i++ {
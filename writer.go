@@ -1,11 +1,27 @@
 package sls
 
-import "encoding/json"
+import (
+	"context"
+	"errors"
+
+	"github.com/gota33/aliyun-log-writer/internal/validator"
+)
+
+// Destination 为日志写入的目标
+type Destination struct {
+	Project string
+	Store   string
+	Topic   string
+}
 
 type Writer struct {
-	worker   worker
-	filter   MessageFilter
-	modifier MessageModifier
+	worker      worker
+	filter      MessageFilter
+	modifier    MessageModifier
+	stats       *stats
+	lines       *lineBuffer
+	parser      Parser
+	destination Destination
 }
 
 func New(c Config) (writer *Writer, err error) {
@@ -13,56 +29,138 @@ func New(c Config) (writer *Writer, err error) {
 		return
 	}
 
+	st := &stats{}
 	client := &sls{
-		Client:    c.HttpClient,
-		AppKey:    c.AccessKey,
-		AppSecret: Secret(c.AccessSecret),
-		Uri:       c.uri,
-		Host:      c.uri.Host,
-		Topic:     c.Topic,
-		Source:    c.Source,
-		Timeout:   c.Timeout,
+		Client:        c.HttpClient,
+		Credentials:   c.Credentials,
+		Uri:           c.uri,
+		Host:          c.uri.Host,
+		Topic:         c.Topic,
+		Source:        c.Source,
+		Timeout:       c.Timeout,
+		Retry:         c.Retry,
+		Compression:   c.Compression,
+		MaxLogSize:    c.MaxLogSize,
+		Oversize:      c.Oversize,
+		Tags:          c.Tags,
+		TimeNano:      c.TimeNano,
+		TimeNanoField: c.TimeNanoField,
+		packID:        newPackIDGenerator(),
+		stats:         st,
 	}
+	return newWriter(c, client, st)
+}
+
+// NewWithSender 创建通过 sender 发送日志的 Writer, 复用批量发送, 过滤, 修改及本地缓存等功能,
+// 可用于将日志写入文件, 标准输出或其他日志服务.
+// c 中的 Endpoint, 凭证, Timeout, Retry, Compression 等 SLS 相关字段不会生效, 均可为空.
+func NewWithSender(c Config, sender Sender) (writer *Writer, err error) {
+	if sender == nil {
+		return nil, validator.IllegalArgument("Sender", "is required")
+	}
+	c.validateOptions()
+	return newWriter(c, sender, &stats{})
+}
 
+func newWriter(c Config, sender Sender, st *stats) (writer *Writer, err error) {
 	option := workerOption{
-		bufferSize: c.BufferSize,
-		interval:   c.Interval,
-		onError:    c.OnError,
-		client:     client,
+		bufferSize:      c.BufferSize,
+		batchBytes:      c.BatchBytes,
+		linger:          c.Linger,
+		interval:        c.Interval,
+		overflow:        c.Overflow,
+		overflowTimeout: c.OverflowTimeout,
+		concurrency:     c.Concurrency,
+		partitionKey:    c.PartitionKey,
+		onError:         c.OnError,
+		client:          sender,
+		stats:           st,
+	}
+
+	if c.SpoolDir != "" {
+		if option.spool, err = openSpool(c.SpoolDir, c.SpoolMaxSize, c.SpoolPolicy); err != nil {
+			return
+		}
 	}
 
 	w := newWorker(option)
 	w.Start()
 
 	writer = &Writer{
-		worker:   w,
-		filter:   c.MessageFilter,
-		modifier: c.MessageModifier,
+		worker:      w,
+		filter:      c.MessageFilter,
+		modifier:    c.MessageModifier,
+		stats:       st,
+		lines:       &lineBuffer{},
+		parser:      c.parser(),
+		destination: Destination{Project: c.Project, Store: c.Store, Topic: c.Topic},
 	}
 	return
 }
 
+// Write 写入换行分隔的日志, 每行一条, 由 Config.Parser 解析. 末尾未以换行结尾的数据缓存到下次 Write 或 Shutdown 时处理,
+// 使用 JSONParser 时单独一条完整的 JSON 日志可以不以换行结尾. 部分行解析失败时其余行正常写入, 返回各行的错误.
 func (w Writer) Write(data []byte) (n int, err error) {
-	var msg Message
-	if err = json.Unmarshal(data, &msg); err != nil {
-		return
+	return len(data), w.lines.write(data, w.lineParser(), w.WriteMessage)
+}
+
+func (w Writer) lineParser() Parser {
+	if w.parser == nil {
+		return JSONParser{}
+	}
+	return w.parser
+}
+
+// WriteMessage 写入已解析的日志, 经过 MessageFilter 和 MessageModifier 处理后进入发送缓存
+func (w Writer) WriteMessage(msg Message) error {
+	if w.stats != nil {
+		w.stats.written.Add(1)
 	}
 
 	if w.filter == nil || !w.filter.Filter(msg) {
-		return
+		if w.stats != nil {
+			w.stats.filtered.Add(1)
+		}
+		return nil
 	}
 
 	if w.modifier != nil {
 		msg = w.modifier.Modify(msg)
+		if w.stats != nil {
+			w.stats.modified.Add(1)
+		}
 	}
 
-	if err = w.worker.Submit(msg); err == nil {
-		n = len(data)
+	return w.worker.Submit(msg)
+}
+
+// Flush 立即发送此前写入的所有日志, 等待 PutLogs 返回并汇总发送失败的错误,
+// 适用于函数计算等需要在每次调用结束前确保日志送达的场景.
+func (w Writer) Flush(ctx context.Context) error {
+	return w.worker.Flush(ctx)
+}
+
+// Stats 返回 Writer 当前的运行统计, 可以并发调用
+func (w Writer) Stats() Stats {
+	if w.stats == nil {
+		return Stats{}
 	}
-	return
+	return w.stats.snapshot()
 }
 
-func (w Writer) Close() (err error) {
-	w.worker.Stop()
-	return
+// Destination 返回日志写入的 Project, Store 和 Topic, 可用作监控指标的标签
+func (w Writer) Destination() Destination {
+	return w.destination
+}
+
+// Shutdown 停止接收新日志, 并在 ctx 结束前尽量发送缓存中的日志,
+// 存在未送达的日志时返回 *ShutdownError, 其中包含送达, 失败及放弃的日志条数.
+func (w Writer) Shutdown(ctx context.Context) error {
+	err := w.lines.flush(w.lineParser(), w.WriteMessage)
+	return errors.Join(err, w.worker.Stop(ctx))
+}
+
+// Close 等同于不限时的 Shutdown
+func (w Writer) Close() error {
+	return w.Shutdown(context.Background())
 }
@@ -1,6 +1,7 @@
 package sls
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -48,6 +49,54 @@ func TestWriter(t *testing.T) {
 		assert.Equal(t, 0, mw.count)
 	})
 
+	t.Run("stats", func(t *testing.T) {
+		filter := &MockFilter{block: true}
+		w := Writer{
+			worker:   &MockWorker{},
+			filter:   filter,
+			modifier: &MockModifier{},
+			stats:    &stats{},
+		}
+
+		_, _ = w.Write([]byte(`{}`))
+		filter.block = false
+		_, _ = w.Write([]byte(`{}`))
+
+		st := w.Stats()
+		assert.EqualValues(t, 2, st.Written)
+		assert.EqualValues(t, 1, st.Filtered)
+		assert.EqualValues(t, 1, st.Modified)
+		assert.Zero(t, Writer{}.Stats())
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		mw := &MockWorker{}
+		w := Writer{worker: mw, filter: &MockFilter{}, lines: &lineBuffer{}}
+
+		data := []byte("{\"a\":\"1\"}\n{\"a\":\"2\"}\n{\"a\":")
+		n, err := w.Write(data)
+		assert.NoError(t, err)
+		assert.Equal(t, len(data), n)
+		assert.Equal(t, 2, mw.count)
+
+		_, err = w.Write([]byte("\"3\"}\n{\"a\":\"4\"}"))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, mw.count)
+
+		_, err = w.Write([]byte(`{"a":`))
+		assert.NoError(t, err)
+		assert.ErrorIs(t, w.Close(), ErrIncompleteLine)
+	})
+
+	t.Run("no filter", func(t *testing.T) {
+		mw := &MockWorker{}
+		w := Writer{worker: mw}
+
+		_, err := w.Write([]byte(`{"a":"b"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, mw.count)
+	})
+
 	t.Run("modifier", func(t *testing.T) {
 		msg := Message{
 			Time:     time.Now(),
@@ -65,6 +114,50 @@ func TestWriter(t *testing.T) {
 		assert.Equal(t, msg, mw.lastMessage)
 	})
 
+	t.Run("custom sender", func(t *testing.T) {
+		_, err := NewWithSender(Config{}, nil)
+		assert.Error(t, err)
+
+		sender := &SlowSender{}
+		w, err := NewWithSender(Config{
+			MessageFilter:   &MockFilter{},
+			MessageModifier: &MockModifier{value: Message{Contents: map[string]string{"key": "value"}}},
+		}, sender)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = w.Write([]byte(`{}`))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Flush(context.Background()))
+		assert.NoError(t, w.Close())
+
+		if assert.Len(t, sender.received, 1) {
+			assert.Equal(t, "value", sender.received[0].Contents["key"])
+		}
+		assert.EqualValues(t, 1, w.Stats().Sent)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		mw := &MockWorker{}
+		w := Writer{worker: mw}
+		assert.NoError(t, w.Flush(context.Background()))
+		assert.Equal(t, 1, mw.flushed)
+
+		mw.err = errors.New("test error")
+		assert.ErrorIs(t, w.Flush(context.Background()), mw.err)
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		mw := &MockWorker{running: true}
+		w := Writer{worker: mw}
+		assert.NoError(t, w.Close())
+		assert.False(t, mw.running)
+
+		mw.err = &ShutdownError{Abandoned: 1, Err: context.DeadlineExceeded}
+		assert.ErrorIs(t, w.Shutdown(context.Background()), context.DeadlineExceeded)
+	})
+
 	t.Run("error", func(t *testing.T) {
 		mw := &MockWorker{err: errors.New("test error")}
 		w := Writer{
@@ -80,13 +173,18 @@ func TestWriter(t *testing.T) {
 type MockWorker struct {
 	running     bool
 	count       int
+	flushed     int
 	err         error
 	lastMessage Message
 }
 
-func (w *MockWorker) Start()                   { w.running = true }
-func (w *MockWorker) Stop()                    { w.running = false }
-func (w *MockWorker) Submit(msg Message) error { w.count++; w.lastMessage = msg; return w.err }
+func (w *MockWorker) Start()                         { w.running = true }
+func (w *MockWorker) Stop(ctx context.Context) error { w.running = false; return w.err }
+func (w *MockWorker) Submit(msg Message) error       { w.count++; w.lastMessage = msg; return w.err }
+func (w *MockWorker) Flush(ctx context.Context) error {
+	w.flushed++
+	return w.err
+}
 
 type MockModifier struct {
 	value Message